@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// DefaultTrackingParams are the query parameters stripped from every URL by
+// default. An entry ending in * matches every parameter with that prefix.
+var DefaultTrackingParams = []string{
+	"utm_*", "gclid", "gclsrc", "dclid", "gbraid", "wbraid", "fbclid", "msclkid",
+	"yclid", "twclid", "igshid", "mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi",
+	"mkt_tok", "oly_anon_id", "oly_enc_id", "vero_id",
+}
+
+// urlCanonicalizer canonicalizes every URL entering the spider: sitemap locs,
+// scraped links and /scrape input. URL_TRACKING_PARAMS, a comma separated
+// list, replaces DefaultTrackingParams.
+var urlCanonicalizer = NewURLCanonicalizer(trackingParamsFromEnv())
+
+func trackingParamsFromEnv() []string {
+	value := getEnv("URL_TRACKING_PARAMS", "")
+	if value == "" {
+		return DefaultTrackingParams
+	}
+	var params []string
+	for _, param := range strings.Split(value, ",") {
+		if param = strings.TrimSpace(param); param != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+var errNotHTTPURL = errors.New("not an http(s) URL")
+
+// URLCanonicalizer rewrites URLs into one canonical spelling, so the same page
+// reached through different links is recognised as one.
+type URLCanonicalizer struct {
+	strip    map[string]bool
+	prefixes []string
+}
+
+func NewURLCanonicalizer(trackingParams []string) *URLCanonicalizer {
+	c := &URLCanonicalizer{strip: make(map[string]bool)}
+	for _, param := range trackingParams {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			c.prefixes = append(c.prefixes, prefix)
+		} else {
+			c.strip[param] = true
+		}
+	}
+	return c
+}
+
+// CanonicalURL canonicalizes an absolute URL with urlCanonicalizer. Input that
+// has no canonical form is returned trimmed but otherwise unchanged, so callers
+// passing URLs through never lose one.
+func CanonicalURL(rawURL string) string {
+	canonical, err := urlCanonicalizer.Canonicalize(nil, rawURL)
+	if err != nil {
+		return strings.TrimSpace(rawURL)
+	}
+	return canonical
+}
+
+// Canonicalize resolves ref against base, which may be nil when ref is
+// absolute, and returns its canonical form: scheme and host lowercased, the
+// host in its ASCII form, the default port, fragment and dot segments removed,
+// an empty path written as /, tracking parameters stripped and the remaining
+// query parameters sorted. Only http(s) URLs have a canonical form.
+func (c *URLCanonicalizer) Canonicalize(base *url.URL, ref string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	if base == nil {
+		base = &url.URL{}
+	}
+	// Resolving also removes dot segments, from absolute references too.
+	u := base.ResolveReference(parsed)
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%q is %w", ref, errNotHTTPURL)
+	}
+
+	host, err := canonicalHost(u.Scheme, u.Host)
+	if err != nil {
+		return "", fmt.Errorf("%q has an invalid host: %w", ref, err)
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+	u.RawQuery = c.canonicalQuery(u.RawQuery)
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	return u.String(), nil
+}
+
+// canonicalHost lowercases host, converts an internationalized name to its
+// ASCII form and drops a port that is the scheme's default.
+func canonicalHost(scheme, hostport string) (string, error) {
+	host, port := hostport, ""
+	if h, p, err := net.SplitHostPort(hostport); err == nil {
+		host, port = h, p
+	} else {
+		host = strings.TrimSuffix(host, ":")
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	if host == "" {
+		return "", errors.New("empty host")
+	}
+
+	if !strings.Contains(host, ":") {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", err
+		}
+		host = ascii
+	}
+
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		return net.JoinHostPort(host, port), nil
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]", nil
+	}
+	return host, nil
+}
+
+// canonicalQuery drops tracking parameters and sorts the rest by name, then
+// value. Names and values are decoded and written again with url.QueryEscape, so
+// equivalent encodings such as a%20b and a+b come out the same, and a parameter
+// without a value gets an empty one. A pair that does not decode, because of a
+// bad escape or a semicolon, is kept as it was written.
+func (c *URLCanonicalizer) canonicalQuery(rawQuery string) string {
+	type param struct{ name, value, encoded string }
+	var params []param
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		values, err := url.ParseQuery(pair)
+		if err != nil {
+			name, value, _ := strings.Cut(pair, "=")
+			if !c.isTracking(name) {
+				params = append(params, param{name, value, pair})
+			}
+			continue
+		}
+		for name, value := range values {
+			if !c.isTracking(name) {
+				params = append(params, param{name, value[0], url.QueryEscape(name) + "=" + url.QueryEscape(value[0])})
+			}
+		}
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		if params[i].name != params[j].name {
+			return params[i].name < params[j].name
+		}
+		return params[i].value < params[j].value
+	})
+
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.encoded
+	}
+	return strings.Join(parts, "&")
+}
+
+func (c *URLCanonicalizer) isTracking(name string) bool {
+	name = strings.ToLower(name)
+	if c.strip[name] {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	base, _ := url.Parse("https://example.com/dir/page.html")
+
+	tests := []struct {
+		name string
+		base *url.URL
+		ref  string
+		want string
+	}{
+		{"tracking params, dot segments and fragment", nil, "https://Example.com/a/../b/?utm_source=x#top", "https://example.com/b/"},
+		{"already canonical", nil, "https://example.com/b/", "https://example.com/b/"},
+		{"scheme and host case", nil, "HTTP://WWW.Example.COM/Path", "http://www.example.com/Path"},
+		{"default http port", nil, "http://example.com:80/a", "http://example.com/a"},
+		{"default https port", nil, "https://example.com:443/a", "https://example.com/a"},
+		{"other port kept", nil, "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"empty port", nil, "https://example.com:/a", "https://example.com/a"},
+		{"empty path", nil, "https://example.com", "https://example.com/"},
+		{"trailing dot host", nil, "https://example.com./a", "https://example.com/a"},
+		{"internationalized host", nil, "https://Bücher.example/a", "https://xn--bcher-kva.example/a"},
+		{"ipv6 host", nil, "http://[::1]:80/a", "http://[::1]/a"},
+		{"sorted query", nil, "https://example.com/?b=2&a=1&a=0", "https://example.com/?a=0&a=1&b=2"},
+		{"tracking only query", nil, "https://example.com/?fbclid=1&gclid=2", "https://example.com/"},
+		{"tracking prefix", nil, "https://example.com/?UTM_Medium=x&id=3", "https://example.com/?id=3"},
+		{"empty value kept", nil, "https://example.com/?q=a&empty=&flag", "https://example.com/?empty=&flag=&q=a"},
+		{"percent encoded space", nil, "https://example.com/?q=a%20b", "https://example.com/?q=a+b"},
+		{"plus encoded space", nil, "https://example.com/?q=a+b", "https://example.com/?q=a+b"},
+		{"needlessly encoded letters", nil, "https://example.com/?%71=%41%2d%7e", "https://example.com/?q=A-~"},
+		{"lowercase escapes", nil, "https://example.com/?path=%2fa%2Fb", "https://example.com/?path=%2Fa%2Fb"},
+		{"encoded tracking name", nil, "https://example.com/?utm%5Fsource=x&id=1", "https://example.com/?id=1"},
+		{"undecodable pair kept", nil, "https://example.com/?q=100%&a=1;b=2&c=3", "https://example.com/?a=1;b=2&c=3&q=100%"},
+		{"relative", base, "../other?x=1#frag", "https://example.com/other?x=1"},
+		{"root relative", base, "/top", "https://example.com/top"},
+		{"protocol relative", base, "//cdn.example.com/x", "https://cdn.example.com/x"},
+		{"whitespace", base, "  next.html ", "https://example.com/dir/next.html"},
+		{"dot segments in absolute", nil, "https://example.com/a/./b/../../c", "https://example.com/c"},
+	}
+
+	c := NewURLCanonicalizer(DefaultTrackingParams)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Canonicalize(tt.base, tt.ref)
+			if err != nil {
+				t.Fatalf("Canonicalize(%q) failed: %v", tt.ref, err)
+			}
+			if got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeRejectsNonHTTP(t *testing.T) {
+	c := NewURLCanonicalizer(DefaultTrackingParams)
+	for _, ref := range []string{"mailto:someone@example.com", "javascript:void(0)", "ftp://example.com/a", "https:///path", "relative/without/base"} {
+		if got, err := c.Canonicalize(nil, ref); err == nil {
+			t.Errorf("Canonicalize(%q) = %q, expected an error", ref, got)
+		}
+	}
+	if got := CanonicalURL(" mailto:someone@example.com "); got != "mailto:someone@example.com" {
+		t.Errorf("CanonicalURL should pass unusable input through trimmed, got %q", got)
+	}
+}
+
+func TestCanonicalizeUsesConfiguredParams(t *testing.T) {
+	c := NewURLCanonicalizer([]string{"session", "ref_*"})
+
+	got, err := c.Canonicalize(nil, "https://example.com/?session=1&ref_a=2&utm_source=x")
+	if err != nil {
+		t.Fatalf("Canonicalize failed: %v", err)
+	}
+	if want := "https://example.com/?utm_source=x"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+
+	t.Setenv("URL_TRACKING_PARAMS", " session , ,ref_*")
+	if params := trackingParamsFromEnv(); len(params) != 2 || params[0] != "session" || params[1] != "ref_*" {
+		t.Errorf("Unexpected params from URL_TRACKING_PARAMS: %q", params)
+	}
+}
+
+func TestURLsAreCanonicalizedWhereTheyEnter(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", map[string]string{
+		"/page": `<html><head><base href="/docs/"><link rel="canonical" href="../page?utm_campaign=x"></head>
+<body><a href="intro/../guide?b=2&a=1#part">Guide</a><a href="./guide?a=1&b=2&fbclid=3">Again</a></body></html>`,
+	})
+
+	results, err := ScrapeSitesWith(context.Background(), NewNativeScraper(), []string{server.URL + "/./page?utm_source=feed#top"}, fastScrapeOptions)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	page := results[0]
+	if page.Url != server.URL+"/./page?utm_source=feed#top" || page.CanonicalUrl != server.URL+"/page" || page.Error != "" {
+		t.Fatalf("Expected the canonical input URL to be scraped under the requested one, got %+v", page)
+	}
+	if page.Canonical != server.URL+"/page" {
+		t.Errorf("Unexpected canonical %q", page.Canonical)
+	}
+	if len(page.Links) != 1 || page.Links[0] != server.URL+"/docs/guide?a=1&b=2" {
+		t.Errorf("Expected one canonical link, got %v", page.Links)
+	}
+
+	entry := transformUrl(SitemapUrl{
+		Loc:   "HTTPS://Example.com:443/a/../b?utm_source=x",
+		Links: []SitemapLink{{Rel: "alternate", Hreflang: "de", Href: "https://EXAMPLE.com/de/#x"}},
+	})
+	if entry.Location != "https://example.com/b" || entry.Alternates[0].Location != "https://example.com/de/" {
+		t.Errorf("Sitemap locations should be canonical, got %q and %+v", entry.Location, entry.Alternates)
+	}
+}
+
+func TestScrapeSitesReportsUncanonicalizableURLs(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", map[string]string{
+		"/page": `<html><body><p>Content</p></body></html>`,
+	})
+	urls := []string{"ftp://example.com/file", "http://[::1", server.URL + "/page"}
+
+	results, err := ScrapeSitesWith(context.Background(), NewNativeScraper(), urls, fastScrapeOptions)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+	want := []string{
+		`invalid url: "ftp://example.com/file" is not an http(s) URL`,
+		`invalid url: parse "http://[::1": missing ']' in host`,
+		"",
+	}
+	for i, result := range results {
+		if result.Url != urls[i] || result.Error != want[i] {
+			t.Errorf("Result %d = %q with error %q, want %q", i, result.Url, result.Error, want[i])
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultChunkTokens is the approximate token budget of one chunk, sized
+	// for dense embedding models with a 512 token window.
+	DefaultChunkTokens = 512
+	// DefaultChunkOverlap is how many tokens of the previous chunk a chunk
+	// repeats when a section is too long for one chunk.
+	DefaultChunkOverlap = 64
+
+	// runesPerToken is the usual estimate for English text with subword
+	// tokenizers, close enough to size chunks without a tokenizer.
+	runesPerToken = 4
+)
+
+// ContentHeading is a heading of the main content. Offset is where its section
+// starts in Content, in characters (Unicode code points); the heading's own
+// text is usually the first line there.
+type ContentHeading struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Offset int    `json:"offset"`
+}
+
+// ContentChunk is a piece of the main content sized for embedding. Text is
+// Content[Start:End], with offsets in characters (Unicode code points), and
+// HeadingPath the headings it sits under, outermost first.
+type ContentChunk struct {
+	Text        string   `json:"text"`
+	HeadingPath []string `json:"headingPath,omitempty"`
+	Start       int      `json:"start"`
+	End         int      `json:"end"`
+	Tokens      int      `json:"tokens"`
+}
+
+// approxTokens estimates the number of tokens in n characters.
+func approxTokens(n int) int {
+	return (n + runesPerToken - 1) / runesPerToken
+}
+
+// contentSpan is a range of content, in characters.
+type contentSpan struct{ start, end int }
+
+// ChunkContent splits content, one paragraph per line, into chunks of about
+// maxTokens tokens. Chunks break at line boundaries, and only split a line
+// that is over budget by itself at whitespace. Every heading starts a new
+// chunk. Within a section, consecutive chunks overlap by up to overlapTokens
+// tokens of whole lines; overlap never crosses a heading. A maxTokens of zero
+// or less means no chunks.
+func ChunkContent(content string, headings []ContentHeading, maxTokens, overlapTokens int) []ContentChunk {
+	runes := []rune(content)
+	if maxTokens <= 0 || len(strings.TrimSpace(content)) == 0 {
+		return nil
+	}
+	overlapTokens = min(max(overlapTokens, 0), maxTokens/2)
+
+	sorted := append([]ContentHeading(nil), headings...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	var chunks []ContentChunk
+	var stack []ContentHeading
+	var current []contentSpan
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		start, end := current[0].start, current[len(current)-1].end
+		chunk := ContentChunk{Text: string(runes[start:end]), Start: start, End: end, Tokens: approxTokens(end - start)}
+		for _, heading := range stack {
+			chunk.HeadingPath = append(chunk.HeadingPath, heading.Text)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	next := 0
+	for _, unit := range contentUnits(runes, maxTokens) {
+		if next < len(sorted) && sorted[next].Offset <= unit.start {
+			flush()
+			current = nil
+			for ; next < len(sorted) && sorted[next].Offset <= unit.start; next++ {
+				stack = pushHeading(stack, sorted[next])
+			}
+		} else if len(current) > 0 && approxTokens(unit.end-current[0].start) > maxTokens {
+			flush()
+			current = overlapTail(current, overlapTokens)
+			for len(current) > 0 && approxTokens(unit.end-current[0].start) > maxTokens {
+				current = current[1:]
+			}
+		}
+		current = append(current, unit)
+	}
+	flush()
+
+	return chunks
+}
+
+// pushHeading makes heading the innermost entry of the heading path, closing
+// the sections of the same or a deeper level.
+func pushHeading(stack []ContentHeading, heading ContentHeading) []ContentHeading {
+	for len(stack) > 0 && stack[len(stack)-1].Level >= heading.Level {
+		stack = stack[:len(stack)-1]
+	}
+	return append(stack, heading)
+}
+
+// overlapTail returns the trailing units of a chunk that fit in overlapTokens.
+func overlapTail(units []contentSpan, overlapTokens int) []contentSpan {
+	last := units[len(units)-1].end
+	i := len(units)
+	for i > 0 && approxTokens(last-units[i-1].start) <= overlapTokens {
+		i--
+	}
+	return append([]contentSpan(nil), units[i:]...)
+}
+
+// contentUnits returns the non-empty lines of content, with lines longer than
+// maxTokens split at whitespace into pieces that fit.
+func contentUnits(runes []rune, maxTokens int) []contentSpan {
+	limit := maxTokens * runesPerToken
+	var units []contentSpan
+
+	lineStart := 0
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && runes[i] != '\n' {
+			continue
+		}
+		start, end := trimSpan(runes, lineStart, i)
+		for start < end {
+			cut := end
+			if end-start > limit {
+				cut = start + limit
+				for j := cut; j > start; j-- {
+					if unicode.IsSpace(runes[j]) {
+						cut = j
+						break
+					}
+				}
+			}
+			pieceStart, pieceEnd := trimSpan(runes, start, cut)
+			if pieceStart < pieceEnd {
+				units = append(units, contentSpan{pieceStart, pieceEnd})
+			}
+			start = cut
+		}
+		lineStart = i + 1
+	}
+	return units
+}
+
+func trimSpan(runes []rune, start, end int) (int, int) {
+	for start < end && unicode.IsSpace(runes[start]) {
+		start++
+	}
+	for end > start && unicode.IsSpace(runes[end-1]) {
+		end--
+	}
+	return start, end
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// checkChunks verifies that every chunk is the content between its offsets
+// and stays within the token budget.
+func checkChunks(t *testing.T, content string, chunks []ContentChunk, maxTokens int) {
+	t.Helper()
+	runes := []rune(content)
+	for i, chunk := range chunks {
+		if chunk.Start < 0 || chunk.End > len(runes) || chunk.Start >= chunk.End {
+			t.Fatalf("Chunk %d has invalid offsets %d-%d", i, chunk.Start, chunk.End)
+		}
+		if got := string(runes[chunk.Start:chunk.End]); got != chunk.Text {
+			t.Errorf("Chunk %d text %q does not match content %q at its offsets", i, chunk.Text, got)
+		}
+		if chunk.Tokens > maxTokens {
+			t.Errorf("Chunk %d has %d tokens, over the budget of %d", i, chunk.Tokens, maxTokens)
+		}
+	}
+}
+
+func TestChunkContentFollowsHeadings(t *testing.T) {
+	content := "Intro paragraph\nGuide\nInstall the tool\nConfigure\nSet the options\nUsage\nRun it"
+	headings := []ContentHeading{
+		{Level: 1, Text: "Guide", Offset: 16},
+		{Level: 2, Text: "Configure", Offset: 39},
+		{Level: 1, Text: "Usage", Offset: 65},
+	}
+
+	chunks := ChunkContent(content, headings, 100, 10)
+	checkChunks(t, content, chunks, 100)
+
+	want := []struct {
+		text string
+		path []string
+	}{
+		{"Intro paragraph", nil},
+		{"Guide\nInstall the tool", []string{"Guide"}},
+		{"Configure\nSet the options", []string{"Guide", "Configure"}},
+		{"Usage\nRun it", []string{"Usage"}},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("Expected %d chunks, got %+v", len(want), chunks)
+	}
+	for i, w := range want {
+		if chunks[i].Text != w.text || strings.Join(chunks[i].HeadingPath, "/") != strings.Join(w.path, "/") {
+			t.Errorf("Chunk %d = %q under %q, want %q under %q", i, chunks[i].Text, chunks[i].HeadingPath, w.text, w.path)
+		}
+	}
+}
+
+func TestChunkContentSplitsLongSectionsWithOverlap(t *testing.T) {
+	// Ten lines of 39 characters, 10 tokens each.
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, strings.Repeat(string(rune('a'+i)), 39))
+	}
+	content := strings.Join(lines, "\n")
+
+	chunks := ChunkContent(content, nil, 35, 10)
+	checkChunks(t, content, chunks, 35)
+	if len(chunks) < 4 {
+		t.Fatalf("Expected the section to be split, got %d chunks", len(chunks))
+	}
+	for i := 1; i < len(chunks); i++ {
+		prev, next := chunks[i-1], chunks[i]
+		if next.Start >= prev.End {
+			t.Errorf("Chunk %d should overlap the one before it, got %d-%d after %d-%d", i, next.Start, next.End, prev.Start, prev.End)
+		}
+		if overlap := prev.End - next.Start; approxTokens(overlap) > 10 {
+			t.Errorf("Chunk %d overlaps by %d tokens, more than the 10 allowed", i, approxTokens(overlap))
+		}
+	}
+	if chunks[len(chunks)-1].End != len(content) {
+		t.Error("Chunks should cover the content to its end")
+	}
+
+	// Overlap never reaches back across a heading.
+	headings := []ContentHeading{{Level: 2, Text: "Next", Offset: 5 * 40}}
+	chunks = ChunkContent(content, headings, 35, 10)
+	for _, chunk := range chunks {
+		if chunk.Start < 5*40 && chunk.End > 5*40 {
+			t.Errorf("Chunk %d-%d crosses the heading at %d", chunk.Start, chunk.End, 5*40)
+		}
+	}
+}
+
+func TestChunkContentSplitsLongLines(t *testing.T) {
+	content := "Überblick: " + strings.Repeat("wörter und sätze ", 60)
+
+	chunks := ChunkContent(content, nil, 20, 0)
+	checkChunks(t, content, chunks, 20)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected the line to be split, got %d chunks", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if strings.HasPrefix(chunk.Text, " ") || strings.HasSuffix(chunk.Text, " ") {
+			t.Errorf("Chunk %d should be split at whitespace, got %q", i, chunk.Text)
+		}
+	}
+
+	if chunks := ChunkContent(content, nil, 0, 0); chunks != nil {
+		t.Errorf("A zero budget should disable chunking, got %d chunks", len(chunks))
+	}
+	if chunks := ChunkContent(" \n ", nil, 20, 0); chunks != nil {
+		t.Errorf("Blank content should have no chunks, got %+v", chunks)
+	}
+}
+
+func TestExtractPagePositionsHeadings(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/docs")
+	page, err := ExtractPage(pageURL, strings.NewReader(`<html><body><main>
+<p>Größere Einleitung des Textes</p>
+<h1>Getting started</h1><p>Install the package first</p>
+<h2>Tip</h2><p>Configure the options next</p>
+</main></body></html>`))
+	if err != nil {
+		t.Fatalf("ExtractPage failed: %v", err)
+	}
+
+	runes := []rune(page.Content)
+	want := []struct {
+		level int
+		text  string
+		line  string // the line the heading's section starts at
+	}{
+		{1, "Getting started", "Getting started"},
+		// "Tip" is too short to be kept, its section starts at the next line.
+		{2, "Tip", "Configure the options next"},
+	}
+	if len(page.Headings) != len(want) {
+		t.Fatalf("Expected %d headings, got %+v", len(want), page.Headings)
+	}
+	for i, w := range want {
+		heading := page.Headings[i]
+		if heading.Level != w.level || heading.Text != w.text {
+			t.Errorf("Heading %d = %+v, want h%d %q", i, heading, w.level, w.text)
+		}
+		if !strings.HasPrefix(string(runes[heading.Offset:]), w.line) {
+			t.Errorf("Heading %q should point at %q, got %q", w.text, w.line, string(runes[heading.Offset:]))
+		}
+	}
+}
+
+func TestScrapeSitesChunksContent(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", map[string]string{
+		"/guide": `<html><body><article><p>` + articleText(5, 200) + `</p>
+<h2>Details section</h2><p>` + articleText(6, 200) + `</p></article></body></html>`,
+	})
+
+	opts := fastScrapeOptions
+	opts.ChunkTokens = 200
+	opts.ChunkOverlap = 20
+	results, err := ScrapeSitesWith(context.Background(), NewNativeScraper(), []string{server.URL + "/guide"}, opts)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	result := results[0]
+	if result.Error != "" {
+		t.Fatalf("Unexpected error %q", result.Error)
+	}
+	if len(result.Headings) != 1 || result.Headings[0].Text != "Details section" {
+		t.Fatalf("Expected the h2 to be reported, got %+v", result.Headings)
+	}
+	if len(result.Chunks) < 2 {
+		t.Fatalf("Expected the content to be chunked, got %d chunks", len(result.Chunks))
+	}
+	checkChunks(t, result.Content, result.Chunks, opts.ChunkTokens)
+	last := result.Chunks[len(result.Chunks)-1]
+	if len(last.HeadingPath) != 1 || last.HeadingPath[0] != "Details section" {
+		t.Errorf("Last chunk should sit under the h2, got %q", last.HeadingPath)
+	}
+
+	results, err = ScrapeSitesWith(context.Background(), NewNativeScraper(), []string{server.URL + "/guide"}, fastScrapeOptions)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+	if results[0].Chunks != nil {
+		t.Errorf("Chunking should be off without a token budget, got %d chunks", len(results[0].Chunks))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MaxSitemapSize is the largest uncompressed sitemap the protocol allows (50MB).
+const MaxSitemapSize = 50 * 1024 * 1024
+
+// maxGzipLayers bounds how many times a body is unwrapped, a .xml.gz served with
+// Content-Encoding: gzip arrives compressed twice.
+const maxGzipLayers = 2
+
+var ErrSitemapTooLarge = errors.New("sitemap exceeds maximum uncompressed size")
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// readSitemapBody reads the whole response body through openSitemapBody.
+func readSitemapBody(sitemapURL string, resp *http.Response) ([]byte, error) {
+	body, err := openSitemapBody(sitemapURL, resp)
+	if err != nil {
+		return nil, fmt.Errorf("decompress sitemap failed: %w", err)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read sitemap failed: %w", err)
+	}
+	return data, nil
+}
+
+// openSitemapBody wraps the response body in a reader that transparently
+// decompresses it when the magic bytes, file extension, Content-Type or
+// Content-Encoding say it is gzip. Both the compressed and decompressed streams
+// are capped at MaxSitemapSize, so callers can stream it without buffering.
+func openSitemapBody(sitemapURL string, resp *http.Response) (io.Reader, error) {
+	body := bufio.NewReader(newSizeLimitedReader(resp.Body, MaxSitemapSize))
+	head, _ := body.Peek(512)
+	if !isGzipped(sitemapURL, resp.Header, head) {
+		return body, nil
+	}
+
+	for layer := 0; layer < maxGzipLayers; layer++ {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		body = bufio.NewReader(newSizeLimitedReader(gz, MaxSitemapSize))
+
+		head, _ = body.Peek(len(gzipMagic))
+		if !bytes.HasPrefix(head, gzipMagic) {
+			break
+		}
+	}
+
+	return body, nil
+}
+
+func isGzipped(sitemapURL string, header http.Header, data []byte) bool {
+	if bytes.HasPrefix(data, gzipMagic) {
+		return true
+	}
+	// Servers that label a body as gzip but send it plain are common enough that
+	// the label alone is only trusted when the body is not already readable XML.
+	if looksLikeXML(data) {
+		return false
+	}
+
+	if strings.EqualFold(header.Get("Content-Encoding"), "gzip") {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(strings.Split(header.Get("Content-Type"), ";")[0])) {
+	case "application/gzip", "application/x-gzip":
+		return true
+	}
+	if u, err := url.Parse(sitemapURL); err == nil && strings.HasSuffix(strings.ToLower(u.Path), ".gz") {
+		return true
+	}
+	return false
+}
+
+func looksLikeXML(data []byte) bool {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	return bytes.HasPrefix(trimmed, []byte("<"))
+}
+
+// sizeLimitedReader fails with ErrSitemapTooLarge once more than limit bytes
+// have been read, rather than silently truncating like io.LimitReader.
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func newSizeLimitedReader(r io.Reader, limit int64) *sizeLimitedReader {
+	return &sizeLimitedReader{r: r, remaining: limit}
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrSitemapTooLarge
+	}
+	// Read one byte past the limit so an oversized stream is detected.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrSitemapTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("gzip write failed: %v", err)
+	}
+	writer.Close()
+	return buf.Bytes()
+}
+
+func TestGetSitemapDecompressesGzip(t *testing.T) {
+	doc := []byte(urlSetDoc("/page-1", "/page-2"))
+	compressed := gzipBytes(t, doc)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml.gz":
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(compressed)
+		case "/encoded.xml":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed)
+		case "/double.xml.gz":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipBytes(t, compressed))
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/sitemap.xml.gz", "/encoded.xml", "/double.xml.gz"} {
+		t.Run(path, func(t *testing.T) {
+			data, err := GetSitemap(context.Background(), server.URL+path)
+			if err != nil {
+				t.Fatalf("GetSitemap failed: %v", err)
+			}
+			if !bytes.Equal(data, doc) {
+				t.Errorf("Expected decompressed sitemap, got %q", data)
+			}
+		})
+	}
+}
+
+func TestGetSitemapRejectsCorruptGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write([]byte("definitely not gzip"))
+	}))
+	defer server.Close()
+
+	if _, err := GetSitemap(context.Background(), server.URL+"/sitemap.xml.gz"); err == nil {
+		t.Error("Expected error for corrupt gzip body")
+	}
+}
+
+func TestSizeLimitedReaderStopsGzipBomb(t *testing.T) {
+	bomb := gzipBytes(t, make([]byte, 1<<20))
+
+	gz, err := gzip.NewReader(bytes.NewReader(bomb))
+	if err != nil {
+		t.Fatalf("gzip reader failed: %v", err)
+	}
+	if _, err := io.ReadAll(newSizeLimitedReader(gz, 1024)); !errors.Is(err, ErrSitemapTooLarge) {
+		t.Errorf("Expected ErrSitemapTooLarge, got %v", err)
+	}
+
+	gz, _ = gzip.NewReader(bytes.NewReader(bomb))
+	if data, err := io.ReadAll(newSizeLimitedReader(gz, 1<<20)); err != nil || len(data) != 1<<20 {
+		t.Errorf("Expected body at exactly the limit to pass, got %d bytes err=%v", len(data), err)
+	}
+}
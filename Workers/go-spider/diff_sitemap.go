@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// SnapshotTTL is how long a snapshot token issued by /map/diff stays usable.
+	SnapshotTTL = 7 * 24 * time.Hour
+
+	maxSnapshots = 64
+	// maxSnapshotUrls bounds the URLs and sitemaps of all snapshots together,
+	// a single site may list millions through its indexes.
+	maxSnapshotUrls = 500000
+)
+
+var (
+	ErrUnknownSnapshot  = errors.New("unknown or expired snapshot token")
+	ErrSnapshotTooLarge = errors.New("sitemap too large to keep as a snapshot")
+)
+
+// snapshots holds the URLs of every recent /map/diff run, so callers can send
+// back a short token instead of the whole previous sitemap.
+var snapshots = NewSnapshotStore(SnapshotTTL, maxSnapshots, maxSnapshotUrls)
+
+type SitemapDiff struct {
+	Added   []BackendUrl `json:"Added"`
+	Removed []BackendUrl `json:"Removed"`
+	Changed []UrlChange  `json:"Changed"`
+	// Incomplete lists the sitemaps that could not be mapped this time. Earlier
+	// URLs listed under them are not reported as removed, and no snapshot is
+	// issued for a map with gaps.
+	Incomplete []string `json:"Incomplete,omitempty"`
+	Snapshot   string   `json:"Snapshot,omitempty"`
+}
+
+// UrlChange is the current version of a URL that exists in both sitemaps,
+// along with the names of the fields that differ: LastModified, Priority or
+// Media.
+type UrlChange struct {
+	BackendUrl
+	ChangedFields []string `json:"ChangedFields"`
+}
+
+// DiffSitemaps compares every URL in previous with every URL in current, at any
+// depth of their sitemap trees. URLs are matched by location, the first entry
+// wins when a location is listed by several sitemaps. A URL missing from
+// current only counts as removed when every sitemap previous listed it under
+// was mapped again, a sitemap that failed this time says nothing about its URLs.
+func DiffSitemaps(previous, current BackendSitemap) SitemapDiff {
+	diff := diffUrls(collectUrls(previous), collectUrls(current))
+
+	diff.Incomplete = incompleteSitemaps(current)
+	if len(diff.Incomplete) == 0 {
+		return diff
+	}
+	unknown := make(map[string]bool, len(diff.Incomplete))
+	for _, location := range diff.Incomplete {
+		unknown[sitemapKey(location)] = true
+	}
+	if unknown[sitemapKey(current.Location)] {
+		// The root itself is partial, a crawl that stopped early for one.
+		diff.Removed = []BackendUrl{}
+		return diff
+	}
+
+	maybeListed := urlsUnder(previous, unknown)
+	removed := []BackendUrl{}
+	for _, u := range diff.Removed {
+		if !maybeListed[u.Location] {
+			removed = append(removed, u)
+		}
+	}
+	diff.Removed = removed
+	return diff
+}
+
+// incompleteSitemaps returns the locations of the sitemaps in site that were
+// not fully mapped: the root when it stopped early, and every child that
+// failed, timed out, was disallowed or sits past the depth limit. A child
+// skipped as a cycle is mapped under its ancestor and does not count.
+func incompleteSitemaps(site BackendSitemap) []string {
+	var incomplete []string
+	ancestors := make(map[string]bool)
+
+	var walk func(node BackendSitemap, root bool)
+	walk = func(node BackendSitemap, root bool) {
+		key := sitemapKey(node.Location)
+		if !root && ancestors[key] {
+			return
+		}
+		failed := node.Error != "" || (node.Status != "" && node.Status != StatusFresh && node.Status != StatusCached)
+		if failed || (!root && !node.IsMapped) {
+			incomplete = append(incomplete, node.Location)
+		}
+		ancestors[key] = true
+		for _, child := range node.SitemapIndex {
+			walk(child, false)
+		}
+		delete(ancestors, key)
+	}
+	walk(site, true)
+
+	return incomplete
+}
+
+// urlsUnder returns the locations of the URLs site lists under any of the
+// sitemaps in keys, at any depth.
+func urlsUnder(site BackendSitemap, keys map[string]bool) map[string]bool {
+	locations := make(map[string]bool)
+
+	var walk func(node BackendSitemap, under bool)
+	walk = func(node BackendSitemap, under bool) {
+		under = under || keys[sitemapKey(node.Location)]
+		for _, u := range node.UrlSet {
+			if under {
+				locations[u.Location] = true
+			}
+		}
+		for _, child := range node.SitemapIndex {
+			walk(child, under)
+		}
+	}
+	walk(site, false)
+
+	return locations
+}
+
+func diffUrls(previous, current []BackendUrl) SitemapDiff {
+	diff := SitemapDiff{Added: []BackendUrl{}, Removed: []BackendUrl{}, Changed: []UrlChange{}}
+
+	before := make(map[string]BackendUrl, len(previous))
+	for _, u := range previous {
+		before[u.Location] = u
+	}
+	after := make(map[string]bool, len(current))
+
+	for _, u := range current {
+		after[u.Location] = true
+		old, ok := before[u.Location]
+		if !ok {
+			diff.Added = append(diff.Added, u)
+			continue
+		}
+		if fields := changedFields(old, u); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, UrlChange{BackendUrl: u, ChangedFields: fields})
+		}
+	}
+
+	for _, u := range previous {
+		if !after[u.Location] {
+			diff.Removed = append(diff.Removed, u)
+		}
+	}
+
+	return diff
+}
+
+// collectUrls flattens a sitemap tree into its unique URLs, in document order.
+func collectUrls(site BackendSitemap) []BackendUrl {
+	var urls []BackendUrl
+	seen := make(map[string]bool)
+
+	var walk func(node BackendSitemap)
+	walk = func(node BackendSitemap) {
+		for _, u := range node.UrlSet {
+			if !seen[u.Location] {
+				seen[u.Location] = true
+				urls = append(urls, u)
+			}
+		}
+		for _, child := range node.SitemapIndex {
+			walk(child)
+		}
+	}
+	walk(site)
+
+	return urls
+}
+
+func changedFields(old, current BackendUrl) []string {
+	var fields []string
+	if !sameTime(old.LastModified, current.LastModified) {
+		fields = append(fields, "LastModified")
+	}
+	if old.Priority != current.Priority {
+		fields = append(fields, "Priority")
+	}
+	// Compared in their wire form, a previous sitemap sent back by the backend
+	// has been through JSON and lost time zones and pointer identity.
+	oldMedia, _ := json.Marshal(old.Media)
+	currentMedia, _ := json.Marshal(current.Media)
+	if string(oldMedia) != string(currentMedia) {
+		fields = append(fields, "Media")
+	}
+	return fields
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+type SnapshotStore struct {
+	ttl        time.Duration
+	maxEntries int
+	maxUrls    int
+
+	mu      sync.Mutex
+	entries map[string]snapshot
+	urls    int // the size of every stored snapshot
+}
+
+type snapshot struct {
+	baseURL string
+	site    BackendSitemap
+	size    int
+	expires time.Time
+}
+
+func NewSnapshotStore(ttl time.Duration, maxEntries, maxUrls int) *SnapshotStore {
+	return &SnapshotStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxUrls:    maxUrls,
+		entries:    make(map[string]snapshot),
+	}
+}
+
+// Save stores site under a new random token. The tree is kept whole so a later
+// diff knows which sitemap listed each URL. The oldest snapshots are evicted
+// until both the entry and URL limits hold, a site too large to ever fit is
+// refused with ErrSnapshotTooLarge.
+func (s *SnapshotStore) Save(baseURL string, site BackendSitemap) (string, error) {
+	size := sitemapSize(site)
+	if size > s.maxUrls {
+		return "", ErrSnapshotTooLarge
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for existing, entry := range s.entries {
+		if now.After(entry.expires) {
+			s.remove(existing)
+		}
+	}
+	for len(s.entries) > 0 && (len(s.entries) >= s.maxEntries || s.urls+size > s.maxUrls) {
+		var oldest string
+		for existing, entry := range s.entries {
+			if oldest == "" || entry.expires.Before(s.entries[oldest].expires) {
+				oldest = existing
+			}
+		}
+		s.remove(oldest)
+	}
+
+	s.entries[token] = snapshot{baseURL: baseURL, site: site, size: size, expires: now.Add(s.ttl)}
+	s.urls += size
+	return token, nil
+}
+
+// Load returns the sitemap saved under token and the base URL it was mapped from.
+func (s *SnapshotStore) Load(token string) (string, BackendSitemap, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[token]
+	if !ok || time.Now().After(entry.expires) {
+		s.remove(token)
+		return "", BackendSitemap{}, ErrUnknownSnapshot
+	}
+	return entry.baseURL, entry.site, nil
+}
+
+// remove drops the snapshot saved under token, callers must hold s.mu.
+func (s *SnapshotStore) remove(token string) {
+	if entry, ok := s.entries[token]; ok {
+		s.urls -= entry.size
+		delete(s.entries, token)
+	}
+}
+
+// sitemapSize counts the URLs and sitemaps of a tree at every depth.
+func sitemapSize(site BackendSitemap) int {
+	size := len(site.UrlSet)
+	for _, child := range site.SitemapIndex {
+		size += 1 + sitemapSize(child)
+	}
+	return size
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiffSitemapsAcrossTree(t *testing.T) {
+	day := func(d int) *time.Time {
+		value := time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC)
+		return &value
+	}
+	title := "Thumbnail"
+
+	previous := BackendSitemap{SitemapIndex: []BackendSitemap{
+		{UrlSet: []BackendUrl{
+			{Location: "https://example.com/same", LastModified: day(1), Priority: 0.5},
+			{Location: "https://example.com/gone", Priority: 0.5},
+		}},
+		{UrlSet: []BackendUrl{
+			{Location: "https://example.com/dated", LastModified: day(1), Priority: 0.5},
+			{Location: "https://example.com/ranked", Priority: 0.5},
+			{Location: "https://example.com/media", Priority: 0.5},
+		}},
+	}}
+	current := BackendSitemap{UrlSet: []BackendUrl{
+		{Location: "https://example.com/same", LastModified: day(1), Priority: 0.5},
+		{Location: "https://example.com/dated", LastModified: day(2), Priority: 0.5},
+		{Location: "https://example.com/ranked", Priority: 0.9},
+		{Location: "https://example.com/media", Priority: 0.5, Media: []BackendMediaEntry{{Location: "https://example.com/a.jpg", Type: Image, Title: &title}}},
+		{Location: "https://example.com/new", Priority: 0.5},
+	}}
+
+	diff := DiffSitemaps(previous, current)
+
+	if got := locations(diff.Added); len(got) != 1 || got[0] != "https://example.com/new" {
+		t.Errorf("Unexpected added urls %v", got)
+	}
+	if got := locations(diff.Removed); len(got) != 1 || got[0] != "https://example.com/gone" {
+		t.Errorf("Unexpected removed urls %v", got)
+	}
+
+	expected := map[string]string{
+		"https://example.com/dated":  "LastModified",
+		"https://example.com/ranked": "Priority",
+		"https://example.com/media":  "Media",
+	}
+	if len(diff.Changed) != len(expected) {
+		t.Fatalf("Expected %d changed urls, got %+v", len(expected), diff.Changed)
+	}
+	for _, change := range diff.Changed {
+		if fields := change.ChangedFields; len(fields) != 1 || fields[0] != expected[change.Location] {
+			t.Errorf("%s: unexpected changed fields %v", change.Location, fields)
+		}
+	}
+}
+
+func TestDiffRequestWithSnapshotToken(t *testing.T) {
+	var mu sync.Mutex
+	pages := urlSetDoc("/a", "/b")
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "Sitemap: %s/sitemap.xml\n", server.URL)
+		case "/sitemap.xml":
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprint(w, strings.ReplaceAll(pages, "{{host}}", server.URL))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	diffRequest := func(body string) (*httptest.ResponseRecorder, SitemapDiff) {
+		rec := httptest.NewRecorder()
+		diffRequestHandler(rec, httptest.NewRequest(http.MethodPost, "/map/diff", bytes.NewBufferString(body)))
+		var diff SitemapDiff
+		json.NewDecoder(rec.Body).Decode(&diff)
+		return rec, diff
+	}
+
+	rec, first := diffRequest(fmt.Sprintf(`{"url": %q}`, server.URL))
+	if rec.Code != http.StatusOK || len(first.Added) != 2 || first.Snapshot == "" {
+		t.Fatalf("First diff should add everything and issue a snapshot: code=%d diff=%+v", rec.Code, first)
+	}
+
+	mu.Lock()
+	pages = urlSetDoc("/b", "/c")
+	mu.Unlock()
+
+	rec, second := diffRequest(fmt.Sprintf(`{"url": %q, "snapshot": %q}`, server.URL, first.Snapshot))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Second diff failed with %d", rec.Code)
+	}
+	if got := locations(second.Added); len(got) != 1 || got[0] != server.URL+"/c" {
+		t.Errorf("Unexpected added urls %v", got)
+	}
+	if got := locations(second.Removed); len(got) != 1 || got[0] != server.URL+"/a" {
+		t.Errorf("Unexpected removed urls %v", got)
+	}
+	if len(second.Changed) != 0 || second.Snapshot == first.Snapshot {
+		t.Errorf("Unexpected changes %+v or reused snapshot", second.Changed)
+	}
+
+	if rec, _ := diffRequest(fmt.Sprintf(`{"url": %q, "snapshot": "unknown"}`, server.URL)); rec.Code != http.StatusNotFound {
+		t.Errorf("Unknown snapshot should be a 404, got %d", rec.Code)
+	}
+	if rec, _ := diffRequest(fmt.Sprintf(`{"url": "https://example.com", "snapshot": %q}`, second.Snapshot)); rec.Code != http.StatusNotFound {
+		t.Errorf("Snapshot of another site should be rejected, got %d", rec.Code)
+	}
+}
+
+func TestDiffKeepsUrlsOfUnmappedSitemaps(t *testing.T) {
+	var mu sync.Mutex
+	blogDown := false
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/robots.txt":
+			fmt.Fprintf(w, "Sitemap: %s/index.xml\n", server.URL)
+		case r.URL.Path == "/index.xml":
+			fmt.Fprint(w, strings.ReplaceAll(sitemapIndexDoc("/pages.xml", "/blog.xml"), "{{host}}", server.URL))
+		case r.URL.Path == "/pages.xml" && !blogDown:
+			fmt.Fprint(w, strings.ReplaceAll(urlSetDoc("/about", "/old"), "{{host}}", server.URL))
+		case r.URL.Path == "/pages.xml":
+			fmt.Fprint(w, strings.ReplaceAll(urlSetDoc("/about"), "{{host}}", server.URL))
+		case r.URL.Path == "/blog.xml" && !blogDown:
+			fmt.Fprint(w, strings.ReplaceAll(urlSetDoc("/post-1", "/post-2"), "{{host}}", server.URL))
+		case r.URL.Path == "/blog.xml":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	diffRequest := func(body string) SitemapDiff {
+		rec := httptest.NewRecorder()
+		diffRequestHandler(rec, httptest.NewRequest(http.MethodPost, "/map/diff", bytes.NewBufferString(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Diff failed with %d: %s", rec.Code, rec.Body.String())
+		}
+		var diff SitemapDiff
+		json.NewDecoder(rec.Body).Decode(&diff)
+		return diff
+	}
+
+	first := diffRequest(fmt.Sprintf(`{"url": %q}`, server.URL))
+	if len(first.Added) != 4 || first.Snapshot == "" || len(first.Incomplete) != 0 {
+		t.Fatalf("First diff should add everything and issue a snapshot, got %+v", first)
+	}
+
+	mu.Lock()
+	blogDown = true
+	mu.Unlock()
+
+	second := diffRequest(fmt.Sprintf(`{"url": %q, "snapshot": %q}`, server.URL, first.Snapshot))
+	if got := locations(second.Removed); len(got) != 1 || got[0] != server.URL+"/old" {
+		t.Errorf("Only the URL dropped from a mapped sitemap should be removed, got %v", got)
+	}
+	if len(second.Incomplete) != 1 || second.Incomplete[0] != server.URL+"/blog.xml" {
+		t.Errorf("Expected the failed sitemap to be reported, got %v", second.Incomplete)
+	}
+	if second.Snapshot != "" {
+		t.Error("A partial map should not be saved as a snapshot")
+	}
+}
+
+func TestIncompleteSitemapsIgnoresCycles(t *testing.T) {
+	site := BackendSitemap{Location: "https://example.com", IsMapped: true, SitemapIndex: []BackendSitemap{
+		{Location: "https://example.com/index.xml", IsMapped: true, Status: StatusCached, SitemapIndex: []BackendSitemap{
+			{Location: "https://example.com/index.xml"},
+			{Location: "https://example.com/deep.xml"},
+		}},
+		{Location: "https://example.com/private.xml", Status: StatusDisallowed},
+	}}
+
+	got := incompleteSitemaps(site)
+	if len(got) != 2 || got[0] != "https://example.com/deep.xml" || got[1] != "https://example.com/private.xml" {
+		t.Errorf("Expected the unmapped and disallowed sitemaps but not the cycle, got %v", got)
+	}
+
+	crawled := BackendSitemap{Location: "https://example.com", IsMapped: true, Error: "crawl stopped after 3 pages"}
+	previous := BackendSitemap{Location: "https://example.com", UrlSet: []BackendUrl{{Location: "https://example.com/gone"}}}
+	if diff := DiffSitemaps(previous, crawled); len(diff.Removed) != 0 {
+		t.Errorf("A crawl that stopped early should not remove anything, got %v", locations(diff.Removed))
+	}
+}
+
+func TestSnapshotStoreBoundsUrls(t *testing.T) {
+	withUrls := func(n int) BackendSitemap {
+		return BackendSitemap{Location: "https://example.com", SitemapIndex: []BackendSitemap{
+			{Location: "https://example.com/pages.xml", UrlSet: make([]BackendUrl, n-1)},
+		}}
+	}
+
+	store := NewSnapshotStore(time.Hour, 10, 100)
+	first, _ := store.Save("https://example.com", withUrls(60))
+	second, _ := store.Save("https://example.com", withUrls(30))
+	if _, err := store.Save("https://example.com", withUrls(30)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, _, err := store.Load(first); err != ErrUnknownSnapshot {
+		t.Error("Oldest snapshot should make room for the url limit")
+	}
+	if _, _, err := store.Load(second); err != nil || store.urls != 60 {
+		t.Errorf("Expected the two newest snapshots with 60 urls, got %d urls: %v", store.urls, err)
+	}
+
+	if _, err := store.Save("https://example.com", withUrls(101)); err != ErrSnapshotTooLarge || store.urls != 60 {
+		t.Errorf("A site over the url limit should be refused, got %v with %d urls stored", err, store.urls)
+	}
+}
@@ -1,84 +1,154 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// SitemapFetchTimeout bounds one sitemap download, reading the body included.
+// It is generous because a sitemap may be tens of megabytes.
+const SitemapFetchTimeout = 2 * time.Minute
+
+var sitemapClient = &http.Client{Timeout: SitemapFetchTimeout}
+
 var commonSitemaps = []string{
 	"/sitemap.xml",
 	"/sitemap_index.xml",
 	"/sitemap/sitemap.xml",
 	"/sitemap-index.xml",
 	"/sitemaps.xml",
+	"/sitemap.txt",
+	"/feed.xml",
+	"/rss.xml",
+	"/atom.xml",
+	"/index.xml",
+	"/feed",
 }
 
-func FindSitemap(baseURL string) ([]byte, error) {
-	sitemapUrl, err := checkRobots(baseURL)
-	if err != nil {
-		return nil, fmt.Errorf("sitemap url check failed: %v", err)
+// probedSitemap is a sitemap that discovery already loaded from a common
+// location. Mapping starts from it rather than loading it again, which would
+// report the copy discovery just cached as unchanged.
+type probedSitemap struct {
+	location string
+	sitemap  Sitemap
+	status   FetchStatus
+}
+
+// FindSitemap returns the location of every sitemap declared in robots.txt for
+// baseURL. Sites that declare none fall back to the first common location that
+// serves a sitemap.
+func FindSitemap(ctx context.Context, baseURL string) ([]string, error) {
+	locations, _, err := findSitemaps(ctx, baseURL)
+	return locations, err
+}
+
+// findSitemaps is FindSitemap that also returns the sitemap found at a common
+// location, nil when robots.txt declared the sitemaps.
+func findSitemaps(ctx context.Context, baseURL string) ([]string, *probedSitemap, error) {
+	sitemapUrls := checkRobots(ctx, baseURL)
+	if len(sitemapUrls) > 0 {
+		return sitemapUrls, nil, nil
 	}
-	if sitemapUrl != "" {
-		return GetSitemap(sitemapUrl)
+
+	probed, err := checkMostCommonConfigs(ctx, baseURL)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	resp, err := checkMostCommonConfigs(baseURL)
+	return []string{probed.location}, probed, nil
+}
+
+func GetSitemap(ctx context.Context, baseURL string) ([]byte, error) {
+	resp, err := fetchSitemap(ctx, baseURL)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	if resp != nil && len(resp) > 0 {
-		return resp, nil
-	}
+	return readSitemapBody(baseURL, resp)
+}
 
-	return nil, fmt.Errorf("FindSitemap failed: no sitemap found for url: %s", baseURL)
+// fetchSitemap requests a sitemap and returns the successful response, the
+// caller reads it through openSitemapBody and closes it.
+func fetchSitemap(ctx context.Context, sitemapURL string) (*http.Response, error) {
+	return fetchSitemapIfModified(ctx, sitemapURL, nil)
 }
 
-func GetSitemap(baseURL string) ([]byte, error) {
-	resp, err := http.Get(baseURL)
+// fetchSitemapIfModified is fetchSitemap made conditional on the validators of
+// a cached copy. With a cached copy a 304 Not Modified is a successful response
+// too, its body is empty.
+func fetchSitemapIfModified(ctx context.Context, sitemapURL string, cached *sitemapCacheEntry) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("get sitemap failed: %v", err)
+		return nil, fmt.Errorf("get sitemap failed: %w", err)
+	}
+	// Asking for gzip explicitly stops the transport from decoding it for us
+	// without a size limit, openSitemapBody handles it instead.
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("User-Agent", UserAgent)
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := sitemapClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get sitemap failed: %w", err)
 	}
-	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return resp, nil
+	}
 	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
 		return nil, fmt.Errorf("get sitemap failed: status code %d", resp.StatusCode)
 	}
 
-	return io.ReadAll(resp.Body)
+	return resp, nil
 }
 
-func checkRobots(baseURL string) (string, error) {
-	resp, err := http.Get(baseURL + "/" + "robots.txt")
-	if err != nil {
-		return "", err
+func checkRobots(ctx context.Context, baseURL string) []string {
+	robots := robotsFor(ctx, baseURL)
+	if robots == nil {
+		return nil
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
+	var sitemapURLs []string
+	seen := make(map[string]bool)
 
-	lines := strings.Split(string(body), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(strings.ToLower(line), "sitemap:") {
-			sitemapURL := strings.TrimSpace(strings.TrimPrefix(line, "Sitemap:"))
-			return sitemapURL, nil
+	for _, sitemapURL := range robots.Sitemaps {
+		if !seen[sitemapURL] {
+			seen[sitemapURL] = true
+			sitemapURLs = append(sitemapURLs, sitemapURL)
 		}
 	}
-	return "", nil
+	return sitemapURLs
 }
 
-func checkMostCommonConfigs(baseURL string) ([]byte, error) {
+func checkMostCommonConfigs(ctx context.Context, baseURL string) (*probedSitemap, error) {
 	for _, path := range commonSitemaps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		fullURL := strings.TrimRight(baseURL, "/") + path
-		resp, err := GetSitemap(fullURL)
+		if !robotsFor(ctx, fullURL).Allowed(UserAgent, fullURL) {
+			continue
+		}
+		sitemap, status, err := LoadSitemap(ctx, fullURL)
+		if err != nil {
+			continue
+		}
 
-		if err == nil && resp != nil && len(resp) > 0 {
-			return resp, nil
+		// Soft 404 pages answer 200 at every path, only accept documents that parse.
+		if len(sitemap.UrlSet.URL) > 0 || len(sitemap.SiteIndex.Sitemap) > 0 {
+			return &probedSitemap{location: fullURL, sitemap: sitemap, status: status}, nil
 		}
 	}
 
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckRobotsReturnsEverySitemap(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/robots.txt": "User-agent: *\r\nDisallow: /admin\r\n" +
+			"Sitemap: {{host}}/pages.xml\r\n" +
+			"SITEMAP: {{host}}/posts.xml\r\n" +
+			"  sitemap:{{host}}/products.xml\r\n" +
+			"Sitemap: {{host}}/pages.xml\r\n",
+	})
+
+	sitemaps := checkRobots(context.Background(), server.URL)
+
+	expected := []string{server.URL + "/pages.xml", server.URL + "/posts.xml", server.URL + "/products.xml"}
+	if len(sitemaps) != len(expected) {
+		t.Fatalf("Expected %d sitemaps, got %v", len(expected), sitemaps)
+	}
+	for i := range expected {
+		if sitemaps[i] != expected[i] {
+			t.Errorf("Sitemap %d: got %s, want %s", i, sitemaps[i], expected[i])
+		}
+	}
+}
+
+func TestMapSiteMergesDeclaredSitemaps(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/robots.txt":      "Sitemap: {{host}}/pages.xml\nSitemap: {{host}}/posts_index.xml\nSitemap: {{host}}/missing.xml\n",
+		"/pages.xml":       urlSetDoc("/about", "/contact"),
+		"/posts_index.xml": sitemapIndexDoc("/posts.xml"),
+		"/posts.xml":       urlSetDoc("/post-1"),
+	})
+
+	site, err := MapSite(context.Background(), server.URL, DefaultSitemapDepth)
+	if err != nil {
+		t.Fatalf("MapSite failed: %v", err)
+	}
+
+	if site.Location != server.URL || !site.IsMapped {
+		t.Errorf("Unexpected site node: location=%s mapped=%v", site.Location, site.IsMapped)
+	}
+	if len(site.SitemapIndex) != 3 {
+		t.Fatalf("Expected 3 declared sitemaps, got %d", len(site.SitemapIndex))
+	}
+	if pages := site.SitemapIndex[0]; !pages.IsMapped || len(pages.UrlSet) != 2 {
+		t.Errorf("pages.xml not populated: mapped=%v urls=%d", pages.IsMapped, len(pages.UrlSet))
+	}
+	if posts := site.SitemapIndex[1]; len(posts.SitemapIndex) != 1 || len(posts.SitemapIndex[0].UrlSet) != 1 {
+		t.Errorf("posts index not expanded: %+v", posts)
+	}
+	if missing := site.SitemapIndex[2]; missing.IsMapped {
+		t.Error("Unreachable sitemap should not be mapped")
+	}
+}
+
+func TestMapSiteFallsBackToCommonLocations(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/sitemap_index.xml": sitemapIndexDoc("/pages.xml"),
+		"/pages.xml":         urlSetDoc("/about"),
+	})
+
+	site, err := MapSite(context.Background(), server.URL, DefaultSitemapDepth)
+	if err != nil {
+		t.Fatalf("MapSite failed: %v", err)
+	}
+	if len(site.SitemapIndex) != 1 || site.SitemapIndex[0].Location != server.URL+"/sitemap_index.xml" {
+		t.Fatalf("Expected common sitemap location as only child, got %+v", site.SitemapIndex)
+	}
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"strconv"
+	"strings"
 	"time"
 )
 
 type ChangeFrequency string
 type MediaType string
+type FetchStatus string
 
 const (
 	Always  ChangeFrequency = "Always"
@@ -20,6 +22,14 @@ const (
 	Image MediaType = "Image"
 	Video MediaType = "Video"
 	News  MediaType = "News"
+
+	StatusDisallowed  FetchStatus = "disallowed"
+	StatusFresh       FetchStatus = "fresh"
+	StatusCached      FetchStatus = "cached"
+	StatusFailed      FetchStatus = "failed"
+	StatusNotASitemap FetchStatus = "not_a_sitemap"
+	StatusMalformed   FetchStatus = "malformed"
+	StatusTimeout     FetchStatus = "timeout"
 )
 
 type BackendSitemap struct {
@@ -29,6 +39,8 @@ type BackendSitemap struct {
 	SitemapIndex []BackendSitemap `json:"SitemapIndex,omitempty"`
 	UrlSet       []BackendUrl     `json:"UrlSet,omitempty"`
 	IsMapped     bool             `json:"IsMapped"`
+	Status       FetchStatus      `json:"Status,omitempty"`
+	Error        string           `json:"Error,omitempty"`
 }
 
 type BackendUrl struct {
@@ -38,6 +50,12 @@ type BackendUrl struct {
 	ChangeFreq   *string             `json:"ChangeFrequency,omitempty"`
 	Priority     float32             `json:"Priority"`
 	Media        []BackendMediaEntry `json:"Media,omitempty"`
+	Alternates   []BackendAlternate  `json:"Alternates,omitempty"`
+}
+
+type BackendAlternate struct {
+	Language string `json:"Language"`
+	Location string `json:"Location"`
 }
 
 type BackendMediaEntry struct {
@@ -60,9 +78,33 @@ type BackendMediaEntry struct {
 	RequiresSubscription *string    `json:"RequiresSubscription,omitempty"`
 	Tag                  *string    `json:"Tag,omitempty"`
 
+	RestrictionRelationship *string        `json:"RestrictionRelationship,omitempty"`
+	PlatformRelationship    *string        `json:"PlatformRelationship,omitempty"`
+	ExpirationDate          *time.Time     `json:"ExpirationDate,omitempty"`
+	FamilyFriendly          *bool          `json:"FamilyFriendly,omitempty"`
+	Live                    *bool          `json:"Live,omitempty"`
+	Uploader                *string        `json:"Uploader,omitempty"`
+	UploaderInfo            *string        `json:"UploaderInfo,omitempty"`
+	Tags                    []string       `json:"Tags,omitempty"`
+	Prices                  []BackendPrice `json:"Prices,omitempty"`
+
+	// Image
+	Caption     *string `json:"Caption,omitempty"`
+	GeoLocation *string `json:"GeoLocation,omitempty"`
+	License     *string `json:"License,omitempty"`
+
 	// News
 	Publication *string `json:"Publication,omitempty"`
 	Language    *string `json:"Language,omitempty"`
+	Keywords    *string `json:"Keywords,omitempty"`
+	Genres      *string `json:"Genres,omitempty"`
+}
+
+type BackendPrice struct {
+	Value      string `json:"Value"`
+	Currency   string `json:"Currency"`
+	Type       string `json:"Type,omitempty"`
+	Resolution string `json:"Resolution,omitempty"`
 }
 
 func TransformToBackendModel(original Sitemap) BackendSitemap {
@@ -74,7 +116,7 @@ func TransformToBackendModel(original Sitemap) BackendSitemap {
 
 	// Transform sub-sitemaps
 	for _, sm := range original.SiteIndex.Sitemap {
-		t, _ := time.Parse(time.RFC3339, sm.Lastmod)
+		t, _, _ := parseW3CDatetime(sm.Lastmod)
 		newSitemap.SitemapIndex = append(newSitemap.SitemapIndex, BackendSitemap{
 			Location:     sm.Loc,
 			LastModified: t,
@@ -84,52 +126,183 @@ func TransformToBackendModel(original Sitemap) BackendSitemap {
 
 	// Transform URLs
 	for _, url := range original.UrlSet.URL {
-		u := BackendUrl{
-			Location: url.Loc,
-			Priority: 0.5, // default
-		}
+		newSitemap.UrlSet = append(newSitemap.UrlSet, transformUrl(url))
+	}
 
-		// Images
-		for _, img := range url.Image {
-			u.Media = append(u.Media, BackendMediaEntry{
-				Location: img.Loc,
-				Type:     Image,
-			})
+	return newSitemap
+}
+
+func transformUrl(url SitemapUrl) BackendUrl {
+	u := BackendUrl{
+		Location:   CanonicalURL(url.Loc),
+		Priority:   parsePriority(url.Priority),
+		ChangeFreq: parseChangeFreq(url.Changefreq),
+	}
+	if lastmod, _, err := parseW3CDatetime(url.Lastmod); err == nil {
+		u.LastModified = &lastmod
+	}
+	u.Alternates = alternatesOf(url)
+	for i := range u.Alternates {
+		u.Alternates[i].Location = CanonicalURL(u.Alternates[i].Location)
+	}
+
+	// Images
+	for _, img := range url.Image {
+		u.Media = append(u.Media, BackendMediaEntry{
+			Location:    img.Loc,
+			Type:        Image,
+			Title:       optionalString(img.Title),
+			Caption:     optionalString(img.Caption),
+			GeoLocation: optionalString(img.GeoLocation),
+			License:     optionalString(img.License),
+		})
+	}
+
+	// Videos
+	for _, vid := range url.Video {
+		rating := parseFloatPointer(vid.Rating)
+		duration := vid.Duration
+		entry := BackendMediaEntry{
+			Location:          vid.ContentLoc,
+			Type:              Video,
+			ThumbnailLocation: &vid.ThumbnailLoc,
+			Title:             &vid.Title,
+			Description:       &vid.Description,
+			ContentLocation:   &vid.ContentLoc,
+			PlayerLocation:    &vid.PlayerLoc,
+			Duration:          &duration,
+			Rating:            rating,
+
+			ViewCount:               parseIntPointer(vid.ViewCount),
+			PublicationDate:         parseTimePointer(vid.PublicationDate),
+			ExpirationDate:          parseTimePointer(vid.ExpirationDate),
+			Restrictions:            optionalString(vid.Restriction.Text),
+			RestrictionRelationship: optionalString(vid.Restriction.Relationship),
+			Platform:                optionalString(vid.Platform.Text),
+			PlatformRelationship:    optionalString(vid.Platform.Relationship),
+			RequiresSubscription:    optionalString(vid.RequiresSubscription),
+			FamilyFriendly:          parseYesNo(vid.FamilyFriendly),
+			Live:                    parseYesNo(vid.Live),
+			Uploader:                optionalString(vid.Uploader.Text),
+			UploaderInfo:            optionalString(vid.Uploader.Info),
+		}
+		// Videos only published through a player have no content_loc.
+		if entry.Location == "" {
+			entry.Location = vid.PlayerLoc
 		}
 
-		// Videos
-		for _, vid := range url.Video {
-			rating := parseFloatPointer(vid.Rating)
-			duration := vid.Duration
-			u.Media = append(u.Media, BackendMediaEntry{
-				Location:          vid.ContentLoc,
-				Type:              Video,
-				ThumbnailLocation: &vid.ThumbnailLoc,
-				Title:             &vid.Title,
-				Description:       &vid.Description,
-				ContentLocation:   &vid.ContentLoc,
-				PlayerLocation:    &vid.PlayerLoc,
-				Duration:          &duration,
-				Rating:            rating,
-			})
+		for _, tag := range vid.Tag {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
 		}
+		// The backend stores a single tag column, so it gets every tag joined.
+		entry.Tag = optionalString(strings.Join(entry.Tags, ","))
 
-		// News
-		if url.News.Publication.Name != "" {
-			pubDate, _ := time.Parse(time.RFC3339, url.News.PublicationDate)
-			u.Media = append(u.Media, BackendMediaEntry{
-				Type:            News,
-				Publication:     &url.News.Publication.Name,
-				Language:        &url.News.Publication.Language,
-				Title:           &url.News.Title,
-				PublicationDate: &pubDate,
+		for _, price := range vid.Price {
+			entry.Prices = append(entry.Prices, BackendPrice{
+				Value:      strings.TrimSpace(price.Text),
+				Currency:   price.Currency,
+				Type:       price.Type,
+				Resolution: price.Resolution,
 			})
 		}
 
-		newSitemap.UrlSet = append(newSitemap.UrlSet, u)
+		u.Media = append(u.Media, entry)
 	}
 
-	return newSitemap
+	// News
+	if url.News.Publication.Name != "" {
+		u.Media = append(u.Media, BackendMediaEntry{
+			Location:        u.Location,
+			Type:            News,
+			Publication:     &url.News.Publication.Name,
+			Language:        &url.News.Publication.Language,
+			Title:           &url.News.Title,
+			PublicationDate: parseTimePointer(url.News.PublicationDate),
+			Keywords:        optionalString(url.News.Keywords),
+			Genres:          optionalString(url.News.Genres),
+		})
+	}
+
+	return u
+}
+
+// DefaultPriority is the sitemap protocol's priority for URLs that do not set one.
+const DefaultPriority float32 = 0.5
+
+// parsePriority reads a <priority> value, falling back to DefaultPriority when it
+// is missing or outside 0.0-1.0.
+func parsePriority(s string) float32 {
+	priority := parseFloatPointer(strings.TrimSpace(s))
+	if priority == nil || *priority < 0 || *priority > 1 {
+		return DefaultPriority
+	}
+	return *priority
+}
+
+// parseChangeFreq maps a <changefreq> value onto the backend's ChangeFrequency
+// names. The backend has no "never", archived pages are rescheduled yearly.
+func parseChangeFreq(s string) *string {
+	var freq ChangeFrequency
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return nil
+	case "always":
+		freq = Always
+	case "hourly":
+		freq = Hourly
+	case "daily":
+		freq = Daily
+	case "weekly":
+		freq = Weekly
+	case "monthly":
+		freq = Monthly
+	case "yearly", "never":
+		freq = Yearly
+	default:
+		freq = Unknown
+	}
+	value := string(freq)
+	return &value
+}
+
+func parseIntPointer(s string) *int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func parseTimePointer(s string) *time.Time {
+	t, _, err := parseW3CDatetime(s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// parseYesNo reads the yes/no flags of the video extension.
+func parseYesNo(s string) *bool {
+	var value bool
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes":
+		value = true
+	case "no":
+		value = false
+	default:
+		return nil
+	}
+	return &value
+}
+
+func optionalString(s string) *string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	return &s
 }
 
 func parseFloatPointer(s string) *float32 {
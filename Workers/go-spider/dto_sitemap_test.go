@@ -0,0 +1,190 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseW3CDatetime(t *testing.T) {
+	tests := []struct {
+		value    string
+		want     time.Time
+		zoneless bool
+	}{
+		{"2025", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2025-06", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2025-06-10", time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC), false},
+		{"2025-06-10T04:30Z", time.Date(2025, 6, 10, 4, 30, 0, 0, time.UTC), false},
+		{"2025-06-10T04:30+02:00", time.Date(2025, 6, 10, 2, 30, 0, 0, time.UTC), false},
+		{"2025-06-10T04:30:15Z", time.Date(2025, 6, 10, 4, 30, 15, 0, time.UTC), false},
+		{"2025-06-10T04:30:15.25-05:00", time.Date(2025, 6, 10, 9, 30, 15, 250000000, time.UTC), false},
+		{" 2025-06-10T04:30:15 ", time.Date(2025, 6, 10, 4, 30, 15, 0, time.UTC), true},
+		{"2025-06-10T04:30", time.Date(2025, 6, 10, 4, 30, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, zoneless, err := parseW3CDatetime(tt.value)
+			if err != nil {
+				t.Fatalf("parseW3CDatetime failed: %v", err)
+			}
+			if !got.Equal(tt.want) || zoneless != tt.zoneless {
+				t.Errorf("Got %v zoneless=%v, want %v zoneless=%v", got, zoneless, tt.want, tt.zoneless)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "10/06/2025", "2025-13-01", "yesterday"} {
+		if _, _, err := parseW3CDatetime(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestTransformCarriesUrlMetadata(t *testing.T) {
+	data := []byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://example.com/a</loc><lastmod>2025-06-10</lastmod><changefreq>daily</changefreq><priority>0.9</priority></url>
+<url><loc>https://example.com/b</loc><changefreq>never</changefreq><priority>7</priority></url>
+<url><loc>https://example.com/c</loc><changefreq>sometimes</changefreq><lastmod>not a date</lastmod></url>
+</urlset>`)
+
+	sitemap, _ := ParseSitemap("https://example.com/sitemap.xml", data)
+	urls := TransformToBackendModel(sitemap).UrlSet
+	if len(urls) != 3 {
+		t.Fatalf("Expected 3 urls, got %d", len(urls))
+	}
+
+	a := urls[0]
+	if a.LastModified == nil || !a.LastModified.Equal(time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected lastmod %v", a.LastModified)
+	}
+	if a.ChangeFreq == nil || *a.ChangeFreq != string(Daily) || a.Priority != 0.9 {
+		t.Errorf("Unexpected changefreq/priority %v %v", a.ChangeFreq, a.Priority)
+	}
+
+	b := urls[1]
+	if b.ChangeFreq == nil || *b.ChangeFreq != string(Yearly) || b.Priority != DefaultPriority {
+		t.Errorf("Unexpected changefreq/priority %v %v", b.ChangeFreq, b.Priority)
+	}
+
+	c := urls[2]
+	if c.LastModified != nil || c.ChangeFreq == nil || *c.ChangeFreq != string(Unknown) {
+		t.Errorf("Unexpected lastmod/changefreq %v %v", c.LastModified, c.ChangeFreq)
+	}
+}
+
+func TestTransformCarriesMediaExtensions(t *testing.T) {
+	data := []byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+  xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"
+  xmlns:video="http://www.google.com/schemas/sitemap-video/1.1"
+  xmlns:news="http://www.google.com/schemas/sitemap-news/0.9">
+<url>
+  <loc>https://example.com/watch</loc>
+  <image:image>
+    <image:loc>https://example.com/a.jpg</image:loc>
+    <image:caption>A caption</image:caption>
+    <image:title>A title</image:title>
+    <image:geo_location>Lyon, France</image:geo_location>
+    <image:license>https://example.com/license</image:license>
+  </image:image>
+  <video:video>
+    <video:thumbnail_loc>https://example.com/thumb.jpg</video:thumbnail_loc>
+    <video:title>Grilling</video:title>
+    <video:description>Steaks</video:description>
+    <video:player_loc>https://example.com/player?v=1</video:player_loc>
+    <video:view_count>12345</video:view_count>
+    <video:publication_date>2025-06-10T19:20:30+08:00</video:publication_date>
+    <video:expiration_date>2030-01-01</video:expiration_date>
+    <video:family_friendly>no</video:family_friendly>
+    <video:restriction relationship="allow">IE GB US CA</video:restriction>
+    <video:platform relationship="deny">tv</video:platform>
+    <video:price currency="EUR" type="rent" resolution="hd">1.99</video:price>
+    <video:price currency="EUR" type="own">9.99</video:price>
+    <video:requires_subscription>yes</video:requires_subscription>
+    <video:uploader info="https://example.com/users/grill">GrillyMcGrillerson</video:uploader>
+    <video:live>yes</video:live>
+    <video:tag>steak</video:tag>
+    <video:tag>meat</video:tag>
+  </video:video>
+  <news:news>
+    <news:publication><news:name>The Example Times</news:name><news:language>en</news:language></news:publication>
+    <news:publication_date>2025-06-10</news:publication_date>
+    <news:title>Grilling season</news:title>
+    <news:keywords>summer, grill</news:keywords>
+    <news:genres>Blog</news:genres>
+  </news:news>
+</url>
+</urlset>`)
+
+	sitemap, _ := ParseSitemap("https://example.com/sitemap.xml", data)
+	urls := TransformToBackendModel(sitemap).UrlSet
+	if len(urls) != 1 || len(urls[0].Media) != 3 {
+		t.Fatalf("Expected 1 url with 3 media entries, got %+v", urls)
+	}
+
+	img := urls[0].Media[0]
+	if img.Caption == nil || *img.Caption != "A caption" || img.Title == nil || *img.Title != "A title" ||
+		img.GeoLocation == nil || *img.GeoLocation != "Lyon, France" || img.License == nil || *img.License != "https://example.com/license" {
+		t.Errorf("Unexpected image entry %+v", img)
+	}
+
+	vid := urls[0].Media[1]
+	if vid.Location != "https://example.com/player?v=1" {
+		t.Errorf("Video without content_loc should fall back to player_loc, got %q", vid.Location)
+	}
+	if vid.ViewCount == nil || *vid.ViewCount != 12345 {
+		t.Errorf("Unexpected view count %v", vid.ViewCount)
+	}
+	if vid.PublicationDate == nil || !vid.PublicationDate.Equal(time.Date(2025, 6, 10, 11, 20, 30, 0, time.UTC)) {
+		t.Errorf("Unexpected publication date %v", vid.PublicationDate)
+	}
+	if vid.ExpirationDate == nil || vid.ExpirationDate.Year() != 2030 {
+		t.Errorf("Unexpected expiration date %v", vid.ExpirationDate)
+	}
+	if vid.FamilyFriendly == nil || *vid.FamilyFriendly || vid.Live == nil || !*vid.Live {
+		t.Errorf("Unexpected flags family_friendly=%v live=%v", vid.FamilyFriendly, vid.Live)
+	}
+	if *vid.Restrictions != "IE GB US CA" || *vid.RestrictionRelationship != "allow" {
+		t.Errorf("Unexpected restriction %v %v", *vid.Restrictions, *vid.RestrictionRelationship)
+	}
+	if *vid.Platform != "tv" || *vid.PlatformRelationship != "deny" {
+		t.Errorf("Unexpected platform %v %v", *vid.Platform, *vid.PlatformRelationship)
+	}
+	if len(vid.Prices) != 2 || vid.Prices[0] != (BackendPrice{Value: "1.99", Currency: "EUR", Type: "rent", Resolution: "hd"}) {
+		t.Errorf("Unexpected prices %+v", vid.Prices)
+	}
+	if *vid.RequiresSubscription != "yes" || *vid.Uploader != "GrillyMcGrillerson" || *vid.UploaderInfo != "https://example.com/users/grill" {
+		t.Errorf("Unexpected subscription/uploader %v %v %v", *vid.RequiresSubscription, *vid.Uploader, *vid.UploaderInfo)
+	}
+	if len(vid.Tags) != 2 || vid.Tag == nil || *vid.Tag != "steak,meat" {
+		t.Errorf("Unexpected tags %v %v", vid.Tags, vid.Tag)
+	}
+
+	news := urls[0].Media[2]
+	if news.Location != "https://example.com/watch" {
+		t.Errorf("News entry should point at the article, got %q", news.Location)
+	}
+	if news.Keywords == nil || *news.Keywords != "summer, grill" || news.Genres == nil || *news.Genres != "Blog" {
+		t.Errorf("Unexpected news keywords/genres %v %v", news.Keywords, news.Genres)
+	}
+	if news.PublicationDate == nil || !news.PublicationDate.Equal(time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected news publication date %v", news.PublicationDate)
+	}
+}
+
+func TestTransformNewsEntry(t *testing.T) {
+	url := SitemapUrl{Loc: "HTTPS://Example.com/article?utm_source=feed"}
+	url.News.Publication.Name = "The Example Times"
+	url.News.PublicationDate = "last tuesday"
+
+	u := transformUrl(url)
+	if len(u.Media) != 1 || u.Media[0].Type != News {
+		t.Fatalf("Expected a news entry, got %+v", u.Media)
+	}
+	if u.Media[0].Location != "https://example.com/article" {
+		t.Errorf("News entry should point at the canonical article, got %q", u.Media[0].Location)
+	}
+	if u.Media[0].PublicationDate != nil {
+		t.Errorf("An unparseable publication date should be left out, got %v", *u.Media[0].PublicationDate)
+	}
+}
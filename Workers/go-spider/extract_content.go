@@ -0,0 +1,333 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// PageContent is what the scrapers extract from one HTML page.
+type PageContent struct {
+	Title       string
+	Description string
+	Keywords    string
+	Links       []string
+	Images      []string
+	Content     string
+	// Canonical is the page's <link rel="canonical">, canonicalized.
+	Canonical  string
+	Structured *StructuredData
+	// Headings are the h1 to h6 of the main content, positioned in Content.
+	Headings []ContentHeading
+}
+
+// Elements that never hold main content, and the class and id patterns of ad
+// and chrome containers, as removed by extract_main_content in extract_data.py.
+var (
+	noiseTags = map[string]bool{
+		"script": true, "style": true, "nav": true, "footer": true, "header": true,
+		"link": true, "meta": true, "noscript": true, "iframe": true,
+	}
+	noiseClasses        = []string{"ad", "advertisement", "sidebar", "comments", "navigation", "header", "footer"}
+	noiseClassFragments = []string{"ad", "sidebar", "widget"}
+	noiseIDFragments    = []string{"ad"}
+
+	// mainContentSelectors are tried in order, the first element that matches
+	// any of them is the main content.
+	mainContentSelectors = []func(*html.Node) bool{
+		isElement("main"),
+		hasAttrValue("role", "main"),
+		hasClass("main-content"),
+		hasClass("content"),
+		hasClass("post-content"),
+		hasClass("article-content"),
+		hasClass("page-content"),
+		hasClass("products-wrap"),
+		hasAttrValue("id", "content"),
+		hasClass("container"),
+		isElement("article"),
+	}
+
+	// codeLinePrefixes mark lines of inlined CSS or JavaScript that leak into
+	// the text of badly built pages.
+	codeLinePrefixes = []string{"@", "function", "var ", "const ", "let ", "if (", "for ("}
+)
+
+// ExtractPage parses an HTML document and extracts its metadata, the absolute
+// http(s) targets of its links and images, resolved against pageURL or the
+// document's <base href>, its structured data and its main content. Links and
+// the canonical URL are canonicalized with urlCanonicalizer.
+func ExtractPage(pageURL *url.URL, body io.Reader) (PageContent, error) {
+	doc, err := html.Parse(body)
+	if err != nil {
+		return PageContent{}, err
+	}
+
+	page := PageContent{Links: []string{}, Images: []string{}}
+	base := pageURL
+	seenLinks := make(map[string]bool)
+	seenImages := make(map[string]bool)
+
+	walkElements(doc, func(n *html.Node) {
+		switch n.Data {
+		case "base":
+			if href := nodeAttr(n, "href"); href != "" && base == pageURL {
+				if resolved, err := pageURL.Parse(strings.TrimSpace(href)); err == nil {
+					base = resolved
+				}
+			}
+		case "title":
+			if page.Title == "" {
+				page.Title = strings.TrimSpace(textOf(n))
+			}
+		case "meta":
+			switch strings.ToLower(nodeAttr(n, "name")) {
+			case "description":
+				page.Description = strings.TrimSpace(nodeAttr(n, "content"))
+			case "keywords":
+				page.Keywords = strings.TrimSpace(nodeAttr(n, "content"))
+			}
+		}
+	})
+
+	// Links and images are resolved once the <base href>, which may come after
+	// the first <link> or <img> in a broken head, is known.
+	walkElements(doc, func(n *html.Node) {
+		switch n.Data {
+		case "link":
+			if page.Canonical == "" && hasToken(nodeAttr(n, "rel"), "canonical") {
+				if canonical, err := urlCanonicalizer.Canonicalize(base, nodeAttr(n, "href")); err == nil {
+					page.Canonical = canonical
+				}
+			}
+		case "a":
+			if href := strings.TrimSpace(nodeAttr(n, "href")); href != "" {
+				if link, err := urlCanonicalizer.Canonicalize(base, href); err == nil {
+					appendUnique(&page.Links, seenLinks, link)
+				}
+			}
+		case "img":
+			appendResolved(&page.Images, seenImages, base, nodeAttr(n, "src"))
+		}
+	})
+
+	// Structured data lives in the script and meta elements extractMainContent removes.
+	page.Structured = extractStructuredData(doc, base)
+	page.Content, page.Headings = extractMainContent(doc)
+	return page, nil
+}
+
+// extractMainContent is a port of extract_main_content: it drops noise
+// elements, picks the main content container and returns its text one line per
+// text node, without lines that look like leaked CSS or JavaScript, along with
+// the headings in it. It removes nodes from doc.
+func extractMainContent(doc *html.Node) (string, []ContentHeading) {
+	removeNodes(doc, isNoise)
+
+	main := findFirst(doc, mainContentSelectors)
+	if main == nil {
+		main = findFirst(doc, []func(*html.Node) bool{isElement("body")})
+	}
+	if main == nil {
+		main = doc
+	}
+
+	var lines []string
+	var headings []ContentHeading
+	var headingLines []int // the line each heading's section starts at
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if level := headingLevel(n); level > 0 {
+			if text := strings.Join(strings.Fields(textOf(n)), " "); text != "" {
+				headings = append(headings, ContentHeading{Level: level, Text: text})
+				headingLines = append(headingLines, len(lines))
+			}
+		}
+		if n.Type == html.TextNode {
+			for _, line := range strings.Split(n.Data, "\n") {
+				if line = strings.TrimSpace(line); isContentLine(line) {
+					lines = append(lines, line)
+				}
+			}
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(main)
+
+	// A heading's own text may be too short to be kept as a line, so its
+	// section starts at whatever line follows it.
+	content := strings.Join(lines, "\n")
+	offset := 0
+	line := 0
+	for i := range headings {
+		for ; line < headingLines[i]; line++ {
+			offset += utf8.RuneCountInString(lines[line]) + 1
+		}
+		headings[i].Offset = min(offset, utf8.RuneCountInString(content))
+	}
+	return content, headings
+}
+
+func headingLevel(n *html.Node) int {
+	if n.Type != html.ElementNode || len(n.Data) != 2 || n.Data[0] != 'h' || n.Data[1] < '1' || n.Data[1] > '6' {
+		return 0
+	}
+	return int(n.Data[1] - '0')
+}
+
+func isContentLine(line string) bool {
+	runes := []rune(line)
+	if len(runes) <= 5 {
+		return false
+	}
+	for _, prefix := range codeLinePrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return false
+		}
+	}
+	if strings.Contains(line, "--") || strings.Contains(line, "::") {
+		return false
+	}
+	if strings.Contains(string(runes[:min(len(runes), 10)]), "{") {
+		return false
+	}
+	return !strings.Contains(string(runes[len(runes)-3:]), "px")
+}
+
+func isNoise(n *html.Node) bool {
+	if noiseTags[n.Data] {
+		return true
+	}
+	for _, class := range noiseClasses {
+		if hasClass(class)(n) {
+			return true
+		}
+	}
+	class := nodeAttr(n, "class")
+	for _, fragment := range noiseClassFragments {
+		if strings.Contains(class, fragment) {
+			return true
+		}
+	}
+	id := nodeAttr(n, "id")
+	for _, fragment := range noiseIDFragments {
+		if strings.Contains(id, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func isElement(tag string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		return n.Data == tag
+	}
+}
+
+func hasClass(class string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		return hasToken(nodeAttr(n, "class"), class)
+	}
+}
+
+func hasAttrValue(key, value string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		for _, a := range n.Attr {
+			if a.Key == key && a.Val == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// findFirst returns the first element in document order matching the first
+// selector that matches anything.
+func findFirst(doc *html.Node, selectors []func(*html.Node) bool) *html.Node {
+	for _, selector := range selectors {
+		var found *html.Node
+		walkElements(doc, func(n *html.Node) {
+			if found == nil && selector(n) {
+				found = n
+			}
+		})
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// removeNodes detaches every element matching match, along with its subtree.
+func removeNodes(n *html.Node, match func(*html.Node) bool) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && match(child) {
+			n.RemoveChild(child)
+		} else {
+			removeNodes(child, match)
+		}
+		child = next
+	}
+}
+
+func walkElements(n *html.Node, visit func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		visit(n)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walkElements(child, visit)
+	}
+}
+
+func textOf(n *html.Node) string {
+	var text strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(n)
+	return text.String()
+}
+
+func nodeAttr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func appendResolved(list *[]string, seen map[string]bool, base *url.URL, ref string) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return
+	}
+	resolved, err := base.Parse(ref)
+	if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+		return
+	}
+	resolved.Fragment = ""
+	resolved.RawFragment = ""
+
+	appendUnique(list, seen, resolved.String())
+}
+
+func appendUnique(list *[]string, seen map[string]bool, value string) {
+	if !seen[value] {
+		seen[value] = true
+		*list = append(*list, value)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExtractPageMetadata(t *testing.T) {
+	page := `<!DOCTYPE html><html><head>
+<title> Example Page </title>
+<meta name="Description" content="An example page">
+<meta name="keywords" content="example, test">
+<base href="https://cdn.example.com/assets/">
+</head><body>
+<a href="/about">About</a>
+<a href="https://other.example.org/x#top">Other</a>
+<a href="/about#team">About again</a>
+<a href="mailto:someone@example.com">Mail</a>
+<img src="logo.png"><img src="">
+</body></html>`
+
+	pageURL, _ := url.Parse("https://example.com/blog/post")
+	got, err := ExtractPage(pageURL, strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("ExtractPage failed: %v", err)
+	}
+
+	if got.Title != "Example Page" || got.Description != "An example page" || got.Keywords != "example, test" {
+		t.Errorf("Unexpected metadata %q %q %q", got.Title, got.Description, got.Keywords)
+	}
+	wantLinks := []string{"https://cdn.example.com/about", "https://other.example.org/x"}
+	if strings.Join(got.Links, " ") != strings.Join(wantLinks, " ") {
+		t.Errorf("Links: got %v, want %v", got.Links, wantLinks)
+	}
+	if len(got.Images) != 1 || got.Images[0] != "https://cdn.example.com/assets/logo.png" {
+		t.Errorf("Unexpected images %v", got.Images)
+	}
+}
+
+func TestExtractMainContentHeuristics(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want []string
+	}{
+		{
+			name: "main element wins over container",
+			page: `<body><div class="container"><p>Container text here</p></div>
+<main><h1>Article heading</h1><p>First paragraph of the article.</p></main></body>`,
+			want: []string{"Article heading", "First paragraph of the article."},
+		},
+		{
+			name: "noise is removed",
+			page: `<body><header>Site header text</header><nav>Navigation links</nav>
+<div class="content"><p>Real content line</p><div class="share-widget">Share this page</div>
+<div id="adslot">Buy things now</div><script>var tracking = true;</script></div>
+<footer>Copyright notice</footer></body>`,
+			want: []string{"Real content line"},
+		},
+		{
+			name: "falls back to body",
+			page: `<body><p>Body paragraph one</p><p>Body paragraph two</p></body>`,
+			want: []string{"Body paragraph one", "Body paragraph two"},
+		},
+		{
+			name: "code-like and short lines are dropped",
+			page: `<body><article><p>Short</p><p>function init() {}</p><p>.x { color: red }</p>
+<p>width: 10px</p><p>a::before content</p><p>--main-color: blue</p><p>Kept sentence.</p></article></body>`,
+			want: []string{"Kept sentence."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pageURL, _ := url.Parse("https://example.com/")
+			got, err := ExtractPage(pageURL, strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatalf("ExtractPage failed: %v", err)
+			}
+			if want := strings.Join(tt.want, "\n"); got.Content != want {
+				t.Errorf("Content:\ngot  %q\nwant %q", got.Content, want)
+			}
+		})
+	}
+}
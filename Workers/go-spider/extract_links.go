@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// extractLinks returns the absolute http(s) targets of every followable <a href>
+// in an HTML document, resolved against pageURL or the document's <base href>
+// and canonicalized. Duplicates are removed, order is preserved.
+func extractLinks(pageURL *url.URL, body io.Reader) []string {
+	base := pageURL
+	seen := make(map[string]bool)
+	var links []string
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "base":
+				if href := attr(token, "href"); href != "" {
+					if resolved, err := pageURL.Parse(href); err == nil {
+						base = resolved
+					}
+				}
+			case "a":
+				href := strings.TrimSpace(attr(token, "href"))
+				if href == "" || hasToken(attr(token, "rel"), "nofollow") {
+					continue
+				}
+				link, err := urlCanonicalizer.Canonicalize(base, href)
+				if err != nil {
+					continue
+				}
+				if !seen[link] {
+					seen[link] = true
+					links = append(links, link)
+				}
+			}
+		}
+	}
+}
+
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether a space separated attribute such as rel contains value.
+func hasToken(list, value string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FetchInfo describes how a page was fetched, so a bad scrape can be told apart
+// from a bad response and slow hosts can be found.
+type FetchInfo struct {
+	StatusCode int `json:"statusCode,omitempty"`
+	// FinalUrl is where the redirects ended, Redirects the hops that led there
+	// in the order they were followed.
+	FinalUrl  string     `json:"finalUrl,omitempty"`
+	Redirects []Redirect `json:"redirects,omitempty"`
+
+	ContentType  string `json:"contentType,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	XRobotsTag   string `json:"xRobotsTag,omitempty"`
+
+	// BodySize is the number of body bytes read, or the declared Content-Length
+	// when the body was not read.
+	BodySize int64       `json:"bodySize,omitempty"`
+	Timing   FetchTiming `json:"timing"`
+}
+
+// Redirect is one hop of a redirect chain: the URL that answered with a
+// redirect and its status.
+type Redirect struct {
+	Url        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// FetchTiming breaks a fetch down in milliseconds. DNS, Connect and TLS add up
+// every connection made along the redirect chain, a phase that did not happen,
+// such as DNS on a reused connection, is zero. A phase the scraper cannot
+// measure is left out: the Python worker only measures Total. TTFB runs from
+// the start of the fetch to the first byte of the final response and is also
+// left out when no response arrived, Total runs to the end of its body.
+type FetchTiming struct {
+	DNS     *float64 `json:"dnsMs,omitempty"`
+	Connect *float64 `json:"connectMs,omitempty"`
+	TLS     *float64 `json:"tlsMs,omitempty"`
+	TTFB    *float64 `json:"ttfbMs,omitempty"`
+	Total   float64  `json:"totalMs"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// fetchTrace records the timing of one request and its redirects through
+// httptrace. Install it with withTrace, then fill a FetchInfo with finish.
+type fetchTrace struct {
+	start time.Time
+
+	// mu guards the rest: a dial the transport started for this request may
+	// still report after the request got another connection.
+	mu                               sync.Mutex
+	dnsStart, connectStart, tlsStart time.Time
+	dns, connect, tls                time.Duration
+	firstByte                        time.Time
+}
+
+func newFetchTrace() *fetchTrace {
+	return &fetchTrace{start: time.Now()}
+}
+
+func (t *fetchTrace) withTrace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.record(func() { t.dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.record(func() { t.dns += time.Since(t.dnsStart) }) },
+		ConnectStart: func(string, string) {
+			t.record(func() { t.connectStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			t.record(func() { t.connect += time.Since(t.connectStart) })
+		},
+		TLSHandshakeStart: func() { t.record(func() { t.tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(func() { t.tls += time.Since(t.tlsStart) })
+		},
+		// Every hop resets it, so the last value is the final response's.
+		GotFirstResponseByte: func() { t.record(func() { t.firstByte = time.Now() }) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+func (t *fetchTrace) record(update func()) {
+	t.mu.Lock()
+	update()
+	t.mu.Unlock()
+}
+
+// finish describes resp, which may be nil when the request failed before a
+// response arrived, with bodySize bytes of its body read.
+func (t *fetchTrace) finish(resp *http.Response, bodySize int64) FetchInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dns, connect, tls := milliseconds(t.dns), milliseconds(t.connect), milliseconds(t.tls)
+	info := FetchInfo{
+		Timing: FetchTiming{
+			DNS:     &dns,
+			Connect: &connect,
+			TLS:     &tls,
+			Total:   milliseconds(time.Since(t.start)),
+		},
+	}
+	if !t.firstByte.IsZero() {
+		ttfb := milliseconds(t.firstByte.Sub(t.start))
+		info.Timing.TTFB = &ttfb
+	}
+	if resp == nil {
+		return info
+	}
+
+	info.StatusCode = resp.StatusCode
+	info.FinalUrl = resp.Request.URL.String()
+	info.Redirects = redirectChain(resp)
+	info.ContentType = resp.Header.Get("Content-Type")
+	info.LastModified = resp.Header.Get("Last-Modified")
+	info.ETag = resp.Header.Get("ETag")
+	info.XRobotsTag = strings.Join(resp.Header.Values("X-Robots-Tag"), ", ")
+	info.BodySize = bodySize
+	if bodySize == 0 && resp.ContentLength > 0 {
+		info.BodySize = resp.ContentLength
+	}
+	return info
+}
+
+// redirectChain walks back from the final response through the redirect
+// responses that caused each request.
+func redirectChain(resp *http.Response) []Redirect {
+	var chain []Redirect
+	for prev := resp.Request.Response; prev != nil; prev = prev.Request.Response {
+		chain = append([]Redirect{{Url: prev.Request.URL.String(), StatusCode: prev.StatusCode}}, chain...)
+	}
+	return chain
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
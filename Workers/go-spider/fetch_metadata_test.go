@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNativeScraperRecordsFetchMetadata(t *testing.T) {
+	const page = `<html><head><title>Final</title></head><body><p>Landed here</p></body></html>`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Add("X-Robots-Tag", "noindex")
+		w.Header().Add("X-Robots-Tag", "nofollow")
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	scraper := &NativeScraper{client: server.Client()}
+	results, err := scraper.Scrape(context.Background(), []string{server.URL + "/old", server.URL + "/gone"})
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+
+	fetch := results[0].Fetch
+	if fetch == nil {
+		t.Fatalf("Expected fetch metadata, got %+v", results[0])
+	}
+	if fetch.StatusCode != http.StatusOK || fetch.FinalUrl != server.URL+"/final" {
+		t.Errorf("Unexpected status %d and final url %q", fetch.StatusCode, fetch.FinalUrl)
+	}
+	wantChain := []Redirect{{server.URL + "/old", http.StatusMovedPermanently}, {server.URL + "/moved", http.StatusFound}}
+	if len(fetch.Redirects) != len(wantChain) {
+		t.Fatalf("Expected redirects %v, got %v", wantChain, fetch.Redirects)
+	}
+	for i, hop := range wantChain {
+		if fetch.Redirects[i] != hop {
+			t.Errorf("Redirect %d: expected %v, got %v", i, hop, fetch.Redirects[i])
+		}
+	}
+	if fetch.ContentType != "text/html; charset=utf-8" || fetch.ETag != `"v1"` || fetch.LastModified != "Mon, 02 Jan 2006 15:04:05 GMT" || fetch.XRobotsTag != "noindex, nofollow" {
+		t.Errorf("Unexpected headers %+v", fetch)
+	}
+	if fetch.BodySize != int64(len(page)) {
+		t.Errorf("Expected body size %d, got %d", len(page), fetch.BodySize)
+	}
+	timing := fetch.Timing
+	if timing.DNS == nil || timing.Connect == nil || timing.TLS == nil || timing.TTFB == nil {
+		t.Fatalf("Native fetches should measure every phase, got %+v", timing)
+	}
+	if *timing.Connect <= 0 || *timing.TLS <= 0 || *timing.TTFB <= 0 || timing.Total < *timing.TTFB {
+		t.Errorf("Unexpected timing %+v", timing)
+	}
+
+	gone := results[1]
+	if gone.Error == "" || gone.Fetch == nil || gone.Fetch.StatusCode != http.StatusGone {
+		t.Errorf("Failed page should still carry its fetch metadata, got %+v", gone)
+	}
+	if err := gone.Validate(); err != nil {
+		t.Errorf("Failed result with fetch metadata should validate: %v", err)
+	}
+}
+
+func TestNativeScraperRecordsTimingWithoutResponse(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	unreachable := server.URL + "/page"
+	server.Close()
+
+	results, _ := NewNativeScraper().Scrape(context.Background(), []string{unreachable})
+
+	fetch := results[0].Fetch
+	if fetch == nil || fetch.StatusCode != 0 || fetch.Timing.Total <= 0 {
+		t.Fatalf("Expected timing without a response, got %+v", fetch)
+	}
+	if fetch.Timing.TTFB != nil {
+		t.Errorf("No response means no time to first byte, got %v", *fetch.Timing.TTFB)
+	}
+}
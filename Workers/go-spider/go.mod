@@ -1,19 +1,21 @@
 module main.go
 
-        go 1.23.0
+go 1.23.0
 
-        toolchain go1.24.9
+toolchain go1.24.9
 
-        require (
-        github.com/go-rod/rod v0.116.2
-        github.com/go-rod/stealth v0.4.9
-        github.com/syumai/workers v0.31.0
-        )
+require (
+	github.com/go-rod/rod v0.116.2
+	github.com/go-rod/stealth v0.4.9
+	github.com/syumai/workers v0.31.0
+	golang.org/x/net v0.42.0
+)
 
-        require (
-        github.com/ysmood/fetchup v0.2.3 // indirect
-        github.com/ysmood/goob v0.4.0 // indirect
-        github.com/ysmood/got v0.40.0 // indirect
-        github.com/ysmood/gson v0.7.3 // indirect
-        github.com/ysmood/leakless v0.9.0 // indirect
-        )
+require (
+	github.com/ysmood/fetchup v0.2.3 // indirect
+	github.com/ysmood/goob v0.4.0 // indirect
+	github.com/ysmood/got v0.40.0 // indirect
+	github.com/ysmood/gson v0.7.3 // indirect
+	github.com/ysmood/leakless v0.9.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
+)
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// hreflangPattern accepts x-default and ISO 639 languages optionally followed by
+// an ISO 15924 script and an ISO 3166-1 or UN M.49 region, e.g. en, en-GB,
+// zh-Hant-TW, es-419.
+var hreflangPattern = regexp.MustCompile(`(?i)^(x-default|[a-z]{2,3}(-[a-z]{4})?(-([a-z]{2}|[0-9]{3}))?)$`)
+
+// alternatesOf returns the alternate-language versions a <url> declares with
+// <xhtml:link rel="alternate" hreflang="..." href="...">. Links with another rel
+// or without a language or href are not alternates and are dropped.
+func alternatesOf(entry SitemapUrl) []BackendAlternate {
+	var alternates []BackendAlternate
+	for _, link := range entry.Links {
+		language := strings.TrimSpace(link.Hreflang)
+		location := strings.TrimSpace(link.Href)
+		if !strings.EqualFold(strings.TrimSpace(link.Rel), "alternate") || language == "" || location == "" {
+			continue
+		}
+		alternates = append(alternates, BackendAlternate{Language: language, Location: location})
+	}
+	return alternates
+}
+
+// validateAlternates checks the hreflang annotations of a urlset. Every page in
+// an alternate set must list itself and be listed back by each alternate, search
+// engines ignore the annotations otherwise. Reciprocity can only be checked for
+// alternates that are in the same document.
+func validateAlternates(report *ValidationReport, urls []SitemapUrl) {
+	declared := make(map[string]map[string]bool)
+	for _, entry := range urls {
+		loc := strings.TrimSpace(entry.Loc)
+		if declared[loc] == nil {
+			declared[loc] = make(map[string]bool)
+		}
+		for _, alternate := range alternatesOf(entry) {
+			declared[loc][alternate.Location] = true
+		}
+	}
+
+	for i, entry := range urls {
+		loc := strings.TrimSpace(entry.Loc)
+		alternates := alternatesOf(entry)
+		if len(alternates) == 0 {
+			continue
+		}
+
+		for _, alternate := range alternates {
+			if !hreflangPattern.MatchString(alternate.Language) {
+				report.add(SeverityError, "invalid_hreflang", i, loc, "hreflang %q is not a language code or x-default", alternate.Language)
+			}
+			if !isAbsoluteHTTPURL(alternate.Location) {
+				report.add(SeverityError, "alternate_not_absolute", i, loc, "alternate %q is not an absolute URL", alternate.Location)
+				continue
+			}
+			if alternate.Location == loc {
+				continue
+			}
+			if back, ok := declared[alternate.Location]; ok && !back[loc] {
+				report.add(SeverityError, "hreflang_not_reciprocal", i, loc, "alternate %s does not link back to this URL", alternate.Location)
+			}
+		}
+
+		if !declared[loc][loc] {
+			report.add(SeverityWarning, "hreflang_missing_self", i, loc, "alternate set does not include the URL itself")
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+const hreflangDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:xhtml="http://www.w3.org/1999/xhtml">
+<url>
+  <loc>https://example.com/en/page</loc>
+  <xhtml:link rel="alternate" hreflang="en" href="https://example.com/en/page"/>
+  <xhtml:link rel="alternate" hreflang="de-DE" href="https://example.com/de/page"/>
+  <xhtml:link rel="alternate" hreflang="x-default" href="https://example.com/en/page"/>
+  <xhtml:link rel="stylesheet" href="https://example.com/style.css"/>
+</url>
+<url>
+  <loc>https://example.com/de/page</loc>
+  <xhtml:link rel="alternate" hreflang="en" href="https://example.com/en/page"/>
+  <xhtml:link rel="alternate" hreflang="de-DE" href="https://example.com/de/page"/>
+</url>
+<url>
+  <loc>https://example.com/fr/page</loc>
+  <xhtml:link rel="alternate" hreflang="fr" href="https://example.com/fr/page"/>
+  <xhtml:link rel="alternate" hreflang="en" href="https://example.com/en/page"/>
+</url>
+<url>
+  <loc>https://example.com/es/page</loc>
+  <xhtml:link rel="alternate" hreflang="spanish" href="https://example.com/en/page"/>
+</url>
+</urlset>`
+
+func TestTransformCarriesAlternates(t *testing.T) {
+	sitemap, _ := ParseSitemap("https://example.com/sitemap.xml", []byte(hreflangDoc))
+	urls := TransformToBackendModel(sitemap).UrlSet
+	if len(urls) != 4 {
+		t.Fatalf("Expected 4 urls, got %d", len(urls))
+	}
+
+	expected := []BackendAlternate{
+		{Language: "en", Location: "https://example.com/en/page"},
+		{Language: "de-DE", Location: "https://example.com/de/page"},
+		{Language: "x-default", Location: "https://example.com/en/page"},
+	}
+	got := urls[0].Alternates
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d alternates, got %+v", len(expected), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Alternate %d: got %+v, want %+v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestValidateAlternatesChecksReciprocity(t *testing.T) {
+	sitemap, _ := ParseSitemap("https://example.com/sitemap.xml", []byte(hreflangDoc))
+	report := ValidateSitemap("https://example.com/sitemap.xml", []byte(hreflangDoc), sitemap)
+
+	// fr/page and es/page both point at en/page, which lists neither back.
+	expected := []struct {
+		code  string
+		index int
+	}{
+		{"hreflang_not_reciprocal", 2},
+		{"invalid_hreflang", 3},
+		{"hreflang_not_reciprocal", 3},
+		{"hreflang_missing_self", 3},
+	}
+	if len(report.Issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %+v", len(expected), report.Issues)
+	}
+	for i, want := range expected {
+		if got := report.Issues[i]; got.Code != want.code || got.Index != want.index {
+			t.Errorf("Issue %d: got %s at %d, want %s at %d", i, got.Code, got.Index, want.code, want.index)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
     "log"
     "net/http"
     "os"
+    "strconv"
+    "time"
 
     "github.com/syumai/workers"
 )
@@ -14,8 +18,16 @@ var (
 	ApiKey          = os.Getenv("API_KEY")
 	ScrapeWorkerUrl = os.Getenv("SCRAPE_WORKER_URL")
 	BackendURL      = os.Getenv("BACKEND_URL")
+	UserAgent       = getEnv("SPIDER_USER_AGENT", "PortfolioSpider/1.0")
 )
 
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
 func main() {
     fmt.Printf("API Key: %s BACKEND_URL: %s SCRAPE_WORKER_URL: %s\n", ApiKey, BackendURL, ScrapeWorkerUrl)
 
@@ -27,6 +39,14 @@ func main() {
 		mapRequestHandler(w, req)
 	})
 
+	http.HandleFunc("/map/diff", func(w http.ResponseWriter, req *http.Request) {
+		diffRequestHandler(w, req)
+	})
+
+	http.HandleFunc("/validate", func(w http.ResponseWriter, req *http.Request) {
+		validateRequestHandler(w, req)
+	})
+
     // Run mode: if not in a Workers environment, start a local HTTP server
     port := os.Getenv("PORT")
     if port == "" {
@@ -64,7 +84,34 @@ func scrapeRequestHandler(w http.ResponseWriter, req *http.Request) {
 	}
 	defer req.Body.Close()
 
-	results, err := ScrapeSites(urls)
+	// ?backend=python|native|auto overrides SCRAPER_BACKEND for this request.
+	scraper, err := NewScraper(req.URL.Query().Get("backend"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// ?timeout=2m bounds the whole batch and ?url_timeout=30s each page, both
+	// override the configured defaults for this request.
+	opts := DefaultScrapeOptions()
+	for param, target := range map[string]*time.Duration{"timeout": &opts.RequestTimeout, "url_timeout": &opts.URLTimeout} {
+		value := req.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("invalid %s %q, expected a duration such as 30s", param, value)})
+			return
+		}
+		*target = d
+	}
+
+	results, err := ScrapeSitesWith(req.Context(), scraper, urls, opts)
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -75,19 +122,42 @@ func scrapeRequestHandler(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(results)
 }
 
+type mapRequest struct {
+	URL   string `json:"url"`
+	Depth *int   `json:"depth,omitempty"`
+
+	// Stream set to "ndjson" writes one BackendUrl per line as it is parsed.
+	Stream string `json:"stream,omitempty"`
+
+	// Timeout bounds the request, a duration such as 2m. A crawl that runs out
+	// of time returns the pages it found so far.
+	Timeout string `json:"timeout,omitempty"`
+
+	// Link crawl limits, used when the site has no sitemap.
+	CrawlDepth *int `json:"crawl_depth,omitempty"`
+	MaxPages   *int `json:"max_pages,omitempty"`
+	SameHost   bool `json:"same_host,omitempty"`
+}
+
 func mapRequestHandler(w http.ResponseWriter, req *http.Request) {
-	var baseURL string
+	var mapReq mapRequest
 
 	if req.Method == http.MethodGet {
-		// ?url=https://example.com
-		baseURL = req.URL.Query().Get("url")
+		// ?url=https://example.com&depth=2&crawl_depth=3&max_pages=100&same_host=true&stream=ndjson&timeout=2m
+		query := req.URL.Query()
+		mapReq.URL = query.Get("url")
+		mapReq.Depth = queryInt(query.Get("depth"))
+		mapReq.CrawlDepth = queryInt(query.Get("crawl_depth"))
+		mapReq.MaxPages = queryInt(query.Get("max_pages"))
+		mapReq.SameHost, _ = strconv.ParseBool(query.Get("same_host"))
+		mapReq.Stream = query.Get("stream")
+		mapReq.Timeout = query.Get("timeout")
 	} else if req.Method == http.MethodPost {
-		// {"url": "https://example.com"}
-		var body map[string]string
-		json.NewDecoder(req.Body).Decode(&body)
-		baseURL = body["url"]
+		// {"url": "https://example.com", "depth": 2, "crawl_depth": 3, "max_pages": 100}
+		json.NewDecoder(req.Body).Decode(&mapReq)
 	}
 
+	baseURL := mapReq.URL
 	if baseURL == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Header().Set("Content-Type", "application/json")
@@ -95,22 +165,304 @@ func mapRequestHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	sitemapData, err := FindSitemap(baseURL)
+	timeout, err := mapReq.timeout()
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(http.StatusBadRequest)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
 
-	sitemap, err := ParseSitemap(baseURL, sitemapData)
+	if mapReq.Stream == "ndjson" {
+		streamMapResponse(ctx, w, mapReq)
+		return
+	}
+
+	site, err := mapReq.mapSite(ctx)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(mapErrorStatus(err))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(site)
+}
+
+// streamMapResponse writes the site's URLs as newline delimited JSON while the
+// sitemaps are still being parsed. Headers are only sent with the first URL, so
+// a site that cannot be mapped at all still gets a JSON error; failures after
+// that are reported in the X-Stream-Error trailer.
+func streamMapResponse(ctx context.Context, w http.ResponseWriter, mapReq mapRequest) {
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+
+	emitUrl := func(u BackendUrl) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Trailer", "X-Stream-Error")
+			started = true
+		}
+		if err := encoder.Encode(u); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	err := StreamSite(ctx, mapReq.URL, mapReq.sitemapDepth(), emitUrl)
+	if err != nil && !started && ctx.Err() == nil {
+		fmt.Printf("Sitemap discovery failed, crawling links instead: %v\n", err)
+		var site BackendSitemap
+		site, err = StartMapping(ctx, mapReq.URL, mapReq.mapOptions())
+		for _, u := range site.UrlSet {
+			if err := emitUrl(u); err != nil {
+				break
+			}
+		}
+		// A crawl cut short still lists its pages, the trailer says why it stopped.
+		if err == nil && started && site.Error != "" {
+			w.Header().Set("X-Stream-Error", site.Error)
+		}
+	}
+
+	if err != nil {
+		if !started {
+			w.WriteHeader(mapErrorStatus(err))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		fmt.Printf("Map stream for %s failed: %v\n", mapReq.URL, err)
+		w.Header().Set("X-Stream-Error", err.Error())
+	}
+}
+
+type diffRequest struct {
+	mapRequest
+
+	// Either the sitemap returned by an earlier /map call, or the snapshot token
+	// returned by an earlier /map/diff call. With neither every URL is added.
+	Previous *BackendSitemap `json:"previous,omitempty"`
+	Snapshot string          `json:"snapshot,omitempty"`
+}
+
+func diffRequestHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": "POST only"})
+		return
+	}
+
+	// {"url": "https://example.com", "snapshot": "..."} or {"url": "https://example.com", "previous": {...}}
+	var diffReq diffRequest
+	if err := json.NewDecoder(req.Body).Decode(&diffReq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+	defer req.Body.Close()
+
+	if diffReq.URL == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": "url parameter required"})
+		return
+	}
+
+	timeout, err := diffReq.timeout()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	var previous BackendSitemap
+	if diffReq.Snapshot != "" {
+		baseURL, saved, err := snapshots.Load(diffReq.Snapshot)
+		if err == nil && baseURL != diffReq.URL {
+			err = fmt.Errorf("snapshot was taken for %s, not %s", baseURL, diffReq.URL)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		previous = saved
+	} else if diffReq.Previous != nil {
+		previous = *diffReq.Previous
+	}
+
+	site, err := diffReq.mapSite(ctx)
+	if err != nil {
+		w.WriteHeader(mapErrorStatus(err))
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
+	// A map with gaps would make the next diff drop whatever the gaps hide,
+	// callers keep diffing against their last complete snapshot instead.
+	diff := DiffSitemaps(previous, site)
+	if len(diff.Incomplete) > 0 {
+		fmt.Printf("Snapshot of %s not saved, %d sitemaps could not be mapped\n", diffReq.URL, len(diff.Incomplete))
+	} else if diff.Snapshot, err = snapshots.Save(diffReq.URL, site); err != nil {
+		fmt.Printf("Snapshot of %s not saved: %v\n", diffReq.URL, err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sitemap)
+	json.NewEncoder(w).Encode(diff)
+}
+
+type validateRequest struct {
+	URL     string `json:"url"`
+	Sitemap string `json:"sitemap,omitempty"`
+	// Timeout bounds the request like it does for /map.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+func validateRequestHandler(w http.ResponseWriter, req *http.Request) {
+	var validateReq validateRequest
+
+	if req.Method == http.MethodGet {
+		// ?url=https://example.com or ?sitemap=https://example.com/sitemap.xml, optionally &timeout=2m
+		validateReq.URL = req.URL.Query().Get("url")
+		validateReq.Sitemap = req.URL.Query().Get("sitemap")
+		validateReq.Timeout = req.URL.Query().Get("timeout")
+	} else if req.Method == http.MethodPost {
+		// {"url": "https://example.com"} or {"sitemap": "https://example.com/sitemap.xml"}
+		json.NewDecoder(req.Body).Decode(&validateReq)
+	}
+
+	if validateReq.URL == "" && validateReq.Sitemap == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": "url or sitemap parameter required"})
+		return
+	}
+
+	timeout, err := requestTimeout(validateReq.Timeout)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	var reports []ValidationReport
+	if validateReq.Sitemap != "" {
+		reports = validateSitemapAt(ctx, validateReq.Sitemap, true)
+	} else {
+		reports, err = ValidateSite(ctx, validateReq.URL)
+	}
+	// Reports cut short by the deadline would blame the sitemaps for it.
+	if err == nil && ctx.Err() != nil {
+		err = fmt.Errorf("validation did not finish: %w", ctx.Err())
+	}
+	if err != nil {
+		w.WriteHeader(mapErrorStatus(err))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// mapSite maps the requested site from its sitemaps, crawling its links when it
+// has none. When the crawl fails too, a broken sitemap is the more useful error.
+// Once ctx has ended there is no point in crawling.
+func (r mapRequest) mapSite(ctx context.Context) (BackendSitemap, error) {
+	site, err := MapSite(ctx, r.URL, r.sitemapDepth())
+	if err == nil {
+		return site, nil
+	}
+	if ctx.Err() != nil {
+		return site, err
+	}
+
+	fmt.Printf("Sitemap discovery failed, crawling links instead: %v\n", err)
+	site, crawlErr := StartMapping(ctx, r.URL, r.mapOptions())
+	if crawlErr != nil && (errors.Is(err, ErrNotASitemap) || errors.Is(err, ErrMalformedXML) || errors.Is(err, ErrSitemapTooLarge)) {
+		return site, err
+	}
+	return site, crawlErr
+}
+
+// mapErrorStatus picks the response status for a site that could not be
+// mapped. A sitemap that is there but is not a sitemap can't be processed, one
+// that is broken or oversized is the upstream server's fault, as is one that
+// took too long, anything else means no sitemap or page was found.
+func mapErrorStatus(err error) int {
+	switch {
+	case isTimeout(err):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrNotASitemap):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrMalformedXML), errors.Is(err, ErrSitemapTooLarge):
+		return http.StatusBadGateway
+	default:
+		return http.StatusNotFound
+	}
+}
+
+func (r mapRequest) sitemapDepth() int {
+	if r.Depth != nil && *r.Depth >= 0 {
+		return *r.Depth
+	}
+	return DefaultSitemapDepth
+}
+
+// timeout returns the requested deadline, or the configured default when none
+// was given.
+func (r mapRequest) timeout() (time.Duration, error) {
+	return requestTimeout(r.Timeout)
+}
+
+// requestTimeout parses the timeout parameter of a sitemap request, falling
+// back to defaultMapTimeout when it is not set.
+func requestTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultMapTimeout(), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q, expected a duration such as 30s", value)
+	}
+	return d, nil
+}
+
+func (r mapRequest) mapOptions() MapOptions {
+	opts := DefaultMapOptions()
+	if r.CrawlDepth != nil && *r.CrawlDepth >= 0 {
+		opts.MaxDepth = *r.CrawlDepth
+	}
+	if r.MaxPages != nil && *r.MaxPages > 0 {
+		opts.MaxPages = *r.MaxPages
+	}
+	opts.SameHost = r.SameHost
+	return opts
+}
+
+func queryInt(value string) *int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &n
 }
@@ -1,5 +1,213 @@
 package main
 
-func StartMapping() {
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	DefaultCrawlDepth = 3
+	DefaultCrawlPages = 500
+	// DefaultMaxCrawlDelay is the longest robots.txt Crawl-delay a crawl waits
+	// out between pages, sites asking for more are only partially crawled.
+	DefaultMaxCrawlDelay = 10 * time.Second
+	// DefaultMapTimeout bounds one /map request, sitemaps and crawl together.
+	DefaultMapTimeout = 5 * time.Minute
+
+	maxCrawlPageSize = 5 * 1024 * 1024
+)
+
+var crawlClient = &http.Client{Timeout: 30 * time.Second}
+
+type MapOptions struct {
+	// MaxDepth is how many links away from the base URL pages are still followed.
+	MaxDepth int
+	// MaxPages caps how many pages are fetched in total.
+	MaxPages int
+	// SameHost limits the crawl to the base URL's exact host instead of its
+	// registrable domain.
+	SameHost bool
+	// MaxCrawlDelay is the longest Crawl-delay honoured, the crawl stops when
+	// the next page asks for more. Zero means no limit.
+	MaxCrawlDelay time.Duration
+}
+
+func DefaultMapOptions() MapOptions {
+	return MapOptions{MaxDepth: DefaultCrawlDepth, MaxPages: DefaultCrawlPages, MaxCrawlDelay: DefaultMaxCrawlDelay}
+}
+
+// defaultMapTimeout returns DefaultMapTimeout, overridden by MAP_REQUEST_TIMEOUT.
+func defaultMapTimeout() time.Duration {
+	if d, err := time.ParseDuration(getEnv("MAP_REQUEST_TIMEOUT", "")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultMapTimeout
+}
+
+type crawlItem struct {
+	url   string
+	depth int
+}
+
+// StartMapping builds a synthetic sitemap for sites that do not publish one by
+// crawling links breadth first from baseURL. Only pages in scope and allowed by
+// robots.txt are fetched, and only HTML pages that loaded are listed. When ctx
+// ends or a page asks for a Crawl-delay above opts.MaxCrawlDelay, the crawl
+// stops early and returns the pages listed so far, with the reason in Error.
+func StartMapping(ctx context.Context, baseURL string, opts MapOptions) (BackendSitemap, error) {
+	startURL, err := urlCanonicalizer.Canonicalize(nil, baseURL)
+	if err != nil {
+		return BackendSitemap{}, fmt.Errorf("StartMapping failed: invalid base url %q", baseURL)
+	}
+	start, _ := url.Parse(startURL)
+	scope := crawlScope(start, opts.SameHost)
+
+	site := BackendSitemap{
+		Location:     baseURL,
+		LastModified: time.Now(),
+	}
+
+	queue := []crawlItem{{url: startURL}}
+	seen := map[string]bool{startURL: true}
+	fetched := 0
+	var stopped error
+
+	for len(queue) > 0 && fetched < opts.MaxPages {
+		if stopped = ctx.Err(); stopped != nil {
+			break
+		}
+		item := queue[0]
+		queue = queue[1:]
+
+		robots := robotsFor(ctx, item.url)
+		if !robots.Allowed(UserAgent, item.url) {
+			continue
+		}
+		if fetched > 0 {
+			delay := robots.CrawlDelay(UserAgent)
+			if opts.MaxCrawlDelay > 0 && delay > opts.MaxCrawlDelay {
+				stopped = fmt.Errorf("Crawl-delay of %s for %s is above the %s limit", delay, item.url, opts.MaxCrawlDelay)
+				break
+			}
+			if stopped = sleepContext(ctx, delay); stopped != nil {
+				break
+			}
+		}
+
+		fetched++
+		page, links, err := crawlPage(ctx, item.url)
+		if err != nil {
+			fmt.Printf("Crawl of %s failed: %v\n", item.url, err)
+			continue
+		}
+		// Redirects are listed under the page they landed on, once.
+		if page.Location != item.url {
+			if seen[page.Location] || !inCrawlScope(page.Location, scope, opts.SameHost) {
+				continue
+			}
+			seen[page.Location] = true
+		}
+		site.UrlSet = append(site.UrlSet, page)
+
+		if item.depth >= opts.MaxDepth {
+			continue
+		}
+		for _, link := range links {
+			if seen[link] || !inCrawlScope(link, scope, opts.SameHost) {
+				continue
+			}
+			seen[link] = true
+			queue = append(queue, crawlItem{url: link, depth: item.depth + 1})
+		}
+	}
+
+	// A page cut off by the deadline is missing even when the queue ran dry.
+	if stopped == nil {
+		stopped = ctx.Err()
+	}
+	if len(site.UrlSet) == 0 {
+		if stopped != nil {
+			return site, fmt.Errorf("StartMapping stopped after %d pages: %w", fetched, stopped)
+		}
+		return site, fmt.Errorf("StartMapping failed: no pages could be crawled for %s", baseURL)
+	}
+	if stopped != nil {
+		fmt.Printf("Crawl of %s stopped after %d pages: %v\n", baseURL, fetched, stopped)
+		site.Error = fmt.Sprintf("crawl stopped after %d pages: %v", fetched, stopped)
+	}
+
+	site.IsMapped = true
+	return site, nil
+}
+
+// crawlPage fetches one page and returns it as a sitemap entry along with the
+// links it contains. The entry is listed under the URL the request ended up at
+// after redirects, non-HTML responses are reported as errors.
+func crawlPage(ctx context.Context, pageURL string) (BackendUrl, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return BackendUrl{}, nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := crawlClient.Do(req)
+	if err != nil {
+		return BackendUrl{}, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return BackendUrl{}, nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return BackendUrl{}, nil, fmt.Errorf("not an html page: %q", mediaType)
+	}
+
+	finalURL := *resp.Request.URL
+
+	page := BackendUrl{
+		Location: CanonicalURL(finalURL.String()),
+		Priority: 0.5, // default
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		page.LastModified = &lastModified
+	}
+
+	links := extractLinks(&finalURL, io.LimitReader(resp.Body, maxCrawlPageSize))
+	return page, links, nil
+}
+
+// crawlScope returns the host or registrable domain the crawl is limited to.
+func crawlScope(start *url.URL, sameHost bool) string {
+	host := strings.ToLower(start.Hostname())
+	if sameHost || net.ParseIP(host) != nil {
+		return host
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+func inCrawlScope(link, scope string, sameHost bool) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if sameHost || net.ParseIP(scope) != nil {
+		return host == scope
+	}
+	return host == scope || strings.HasSuffix(host, "."+scope)
 }
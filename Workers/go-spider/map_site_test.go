@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLinkServer serves each path in pages as an HTML document, with {{host}}
+// replaced by the test server's base URL.
+func newLinkServer(t *testing.T, robots string, pages map[string]string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, robots)
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, strings.ReplaceAll(page, "{{host}}", server.URL))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func locations(urls []BackendUrl) []string {
+	var locs []string
+	for _, u := range urls {
+		locs = append(locs, u.Location)
+	}
+	return locs
+}
+
+func TestStartMappingCrawlsLinks(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nDisallow: /private\n", map[string]string{
+		"/": `<html><body>
+			<a href="/a#top">A</a>
+			<a href="b">B</a>
+			<a href="/nofollow" rel="nofollow">skip</a>
+			<a href="/private/page">private</a>
+			<a href="https://elsewhere.example.org/">external</a>
+			<a href="mailto:me@example.com">mail</a>
+		</body></html>`,
+		"/a":            `<a href="{{host}}/">home</a><a href="/a/deep">deep</a>`,
+		"/b":            `<base href="{{host}}/nested/"><a href="child">child</a>`,
+		"/nested/child": `<p>leaf</p>`,
+		"/a/deep":       `<a href="/a/deeper">deeper</a>`,
+		"/a/deeper":     `<p>too deep</p>`,
+		"/private/page": `<p>secret</p>`,
+		"/nofollow":     `<p>hidden</p>`,
+	})
+
+	site, err := StartMapping(context.Background(), server.URL+"/", MapOptions{MaxDepth: 2, MaxPages: 100})
+	if err != nil {
+		t.Fatalf("StartMapping failed: %v", err)
+	}
+
+	got := strings.Join(locations(site.UrlSet), ",")
+	want := strings.Join([]string{
+		server.URL + "/",
+		server.URL + "/a",
+		server.URL + "/b",
+		server.URL + "/a/deep",
+		server.URL + "/nested/child",
+	}, ",")
+	if got != want {
+		t.Errorf("Unexpected crawl result\n got: %s\nwant: %s", got, want)
+	}
+	if !site.IsMapped {
+		t.Error("Crawled site should be mapped")
+	}
+}
+
+func TestStartMappingStopsAtMaxPages(t *testing.T) {
+	server := newLinkServer(t, "", map[string]string{
+		"/":  `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a>`,
+		"/1": `<p>1</p>`,
+		"/2": `<p>2</p>`,
+		"/3": `<p>3</p>`,
+	})
+
+	site, err := StartMapping(context.Background(), server.URL+"/", MapOptions{MaxDepth: 5, MaxPages: 2})
+	if err != nil {
+		t.Fatalf("StartMapping failed: %v", err)
+	}
+	if len(site.UrlSet) != 2 {
+		t.Errorf("Expected 2 pages, got %v", locations(site.UrlSet))
+	}
+}
+
+func TestCrawlScopeUsesRegistrableDomain(t *testing.T) {
+	start, _ := http.NewRequest(http.MethodGet, "https://www.example.co.uk/", nil)
+	scope := crawlScope(start.URL, false)
+
+	if scope != "example.co.uk" {
+		t.Fatalf("Expected registrable domain scope, got %s", scope)
+	}
+	if !inCrawlScope("https://blog.example.co.uk/post", scope, false) {
+		t.Error("Subdomain should be in scope")
+	}
+	if inCrawlScope("https://example.com/", scope, false) {
+		t.Error("Other domain should be out of scope")
+	}
+	if inCrawlScope("https://blog.example.co.uk/post", "www.example.co.uk", true) {
+		t.Error("Subdomain should be out of scope when limited to the same host")
+	}
+}
+
+func TestMapRequestFallsBackToLinkCrawl(t *testing.T) {
+	server := newLinkServer(t, "", map[string]string{
+		"/":      `<a href="/about">about</a>`,
+		"/about": `<p>about</p>`,
+	})
+
+	rec := httptest.NewRecorder()
+	mapRequestHandler(rec, httptest.NewRequest(http.MethodGet, "/map?url="+server.URL+"/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var site BackendSitemap
+	if err := json.NewDecoder(rec.Body).Decode(&site); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(site.UrlSet) != 2 {
+		t.Errorf("Expected crawled pages in response, got %v", locations(site.UrlSet))
+	}
+}
+
+func TestStartMappingStopsAtLongCrawlDelay(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nCrawl-delay: 3600\n", map[string]string{
+		"/":  `<a href="/1">1</a><a href="/2">2</a>`,
+		"/1": `<p>1</p>`,
+		"/2": `<p>2</p>`,
+	})
+
+	started := time.Now()
+	site, err := StartMapping(context.Background(), server.URL+"/", DefaultMapOptions())
+	if err != nil {
+		t.Fatalf("StartMapping failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Crawl should stop instead of waiting out the delay, took %s", elapsed)
+	}
+	if len(site.UrlSet) != 1 || !site.IsMapped || !strings.Contains(site.Error, "Crawl-delay") {
+		t.Errorf("Expected the first page and the reason the crawl stopped, got %v with error %q", locations(site.UrlSet), site.Error)
+	}
+}
+
+func TestMapRequestHasDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/stuck">stuck</a>`)
+		case "/stuck":
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	rec := httptest.NewRecorder()
+	mapRequestHandler(rec, httptest.NewRequest(http.MethodGet, "/map?timeout=bogus&url="+server.URL+"/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid timeout, got %d", rec.Code)
+	}
+
+	started := time.Now()
+	rec = httptest.NewRecorder()
+	mapRequestHandler(rec, httptest.NewRequest(http.MethodGet, "/map?timeout=500ms&url="+server.URL+"/", nil))
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Request should end at its deadline, took %s", elapsed)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the partial crawl, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var site BackendSitemap
+	if err := json.NewDecoder(rec.Body).Decode(&site); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(site.UrlSet) != 1 || site.Error == "" {
+		t.Errorf("Expected the page found before the deadline and the reason the crawl stopped, got %v with error %q", locations(site.UrlSet), site.Error)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// maxScrapePageSize bounds how much of a page the native scraper reads.
+const maxScrapePageSize = 5 * 1024 * 1024
+
+// NativeScraper fetches pages with net/http and extracts them with ExtractPage,
+// so it needs neither a venv nor a browser. It does not render JavaScript.
+type NativeScraper struct {
+	client *http.Client
+}
+
+func NewNativeScraper() *NativeScraper {
+	return &NativeScraper{client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *NativeScraper) Scrape(ctx context.Context, urls []string) ([]ScrapeResult, error) {
+	results := make([]ScrapeResult, 0, len(urls))
+	for _, url := range urls {
+		page, fetch, err := s.scrapePage(ctx, url)
+		if err != nil {
+			result := failedScrape(url, err)
+			result.Fetch = fetch
+			results = append(results, result)
+			continue
+		}
+		results = append(results, ScrapeResult{
+			SchemaVersion: ScrapeSchemaVersion,
+			Url:           url,
+			Title:         page.Title,
+			Description:   page.Description,
+			Keywords:      page.Keywords,
+			Content:       page.Content,
+			Links:         page.Links,
+			Images:        page.Images,
+			Canonical:     page.Canonical,
+			Structured:    page.Structured,
+			Headings:      page.Headings,
+			Fetch:         fetch,
+		})
+	}
+	return results, nil
+}
+
+// scrapePage fetches and extracts one page. The fetch metadata is returned
+// whenever a request was made, also when the page failed.
+func (s *NativeScraper) scrapePage(ctx context.Context, pageURL string) (PageContent, *FetchInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return PageContent{}, nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	trace := newFetchTrace()
+	resp, err := s.client.Do(trace.withTrace(req))
+	if err != nil {
+		fetch := trace.finish(nil, 0)
+		return PageContent{}, &fetch, err
+	}
+	defer resp.Body.Close()
+
+	body := &countingReader{r: io.LimitReader(resp.Body, maxScrapePageSize)}
+	page, err := readPage(resp, body)
+	fetch := trace.finish(resp, body.n)
+	return page, &fetch, err
+}
+
+func readPage(resp *http.Response, body io.Reader) (PageContent, error) {
+	if err := pageStatusError(resp.StatusCode); err != nil {
+		return PageContent{}, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return PageContent{}, fmt.Errorf("not an html page: %q", mediaType)
+	}
+
+	// Links resolve against where the redirects ended, not the requested URL.
+	return ExtractPage(resp.Request.URL, body)
+}
+
+// pageStatusError is the rule every scraper applies to the final response:
+// only a 200 is a page, anything else fails with its status.
+func pageStatusError(statusCode int) error {
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("status code %d", statusCode)
+	}
+	return nil
+}
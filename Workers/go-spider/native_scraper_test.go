@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNativeScraperScrapesPages(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", map[string]string{
+		"/page": `<html><head><title>Native</title><meta name="description" content="Scraped natively"></head>
+<body><main><p>Content from the page</p><a href="/next">Next</a></main></body></html>`,
+	})
+
+	results, err := ScrapeSitesWith(context.Background(), NewNativeScraper(), []string{server.URL + "/page", server.URL + "/missing"}, fastScrapeOptions)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	page := results[0]
+	if page.Url != server.URL+"/page" || page.Title != "Native" || page.Description != "Scraped natively" {
+		t.Errorf("Unexpected page result %+v", page)
+	}
+	if page.Content != "Content from the page" {
+		t.Errorf("Unexpected content %q", page.Content)
+	}
+	if len(page.Links) != 1 || page.Links[0] != server.URL+"/next" {
+		t.Errorf("Unexpected links %v", page.Links)
+	}
+
+	if missing := results[1]; missing.Url != server.URL+"/missing" || missing.Error != "status code 404" {
+		t.Errorf("Unexpected error result %+v", missing)
+	}
+}
+
+func TestScrapeRequestRejectsUnknownBackend(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/scrape?backend=chrome", strings.NewReader(`["https://example.com"]`))
+	scrapeRequestHandler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown backend, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// DefaultNearDuplicateDistance is how many of the 64 fingerprint bits two
+	// pages may differ in and still count as near-duplicates.
+	DefaultNearDuplicateDistance = 3
+
+	maxFingerprints = 50000
+	// Content shorter than this many words is too small to fingerprint reliably.
+	minFingerprintWords = 8
+	shingleSize         = 3
+)
+
+// fingerprints remembers the most recently scraped pages so that a mirror or
+// print view of one of them is flagged before the backend embeds it.
+// NEAR_DUPLICATE_DISTANCE overrides DefaultNearDuplicateDistance.
+var fingerprints = NewFingerprintIndex(maxFingerprints, nearDuplicateDistanceFromEnv())
+
+func nearDuplicateDistanceFromEnv() int {
+	if n, err := strconv.Atoi(getEnv("NEAR_DUPLICATE_DISTANCE", "")); err == nil && n >= 0 && n <= 64 {
+		return n
+	}
+	return DefaultNearDuplicateDistance
+}
+
+// NearDuplicate names the earlier page a result nearly duplicates. Similarity
+// is the share of fingerprint bits the two have in common, 1 for identical
+// content.
+type NearDuplicate struct {
+	Url        string  `json:"url"`
+	Similarity float64 `json:"similarity"`
+}
+
+// SimHash fingerprints text so that similar texts get fingerprints that differ
+// in few bits. Text is split into lowercased words and hashed as overlapping
+// three word shingles. ok is false when text has too few words to fingerprint.
+func SimHash(text string) (fingerprint uint64, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) < minFingerprintWords {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint, true
+}
+
+func formatFingerprint(fingerprint uint64) string {
+	return fmt.Sprintf("%016x", fingerprint)
+}
+
+func similarity(distance int) float64 {
+	return 1 - float64(distance)/64
+}
+
+// FingerprintIndex holds the fingerprints of the most recent pages, up to
+// maxEntries, replacing the oldest when full. Lookups scan every entry, which
+// at this size is cheap next to fetching a page.
+type FingerprintIndex struct {
+	maxEntries  int
+	maxDistance int
+
+	mu      sync.Mutex
+	entries []fingerprintEntry
+	next    int            // the entry replaced next once the index is full
+	byUrl   map[string]int // index into entries
+}
+
+type fingerprintEntry struct {
+	url         string
+	fingerprint uint64
+}
+
+func NewFingerprintIndex(maxEntries, maxDistance int) *FingerprintIndex {
+	return &FingerprintIndex{
+		maxEntries:  maxEntries,
+		maxDistance: maxDistance,
+		byUrl:       make(map[string]int),
+	}
+}
+
+// Add records the fingerprint of pageURL and returns the closest other page
+// within maxDistance bits of it, or nil when there is none. A page scraped
+// again replaces its own entry rather than matching it.
+func (x *FingerprintIndex) Add(pageURL string, fingerprint uint64) *NearDuplicate {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var match *NearDuplicate
+	best := x.maxDistance + 1
+	for _, entry := range x.entries {
+		if entry.url == pageURL {
+			continue
+		}
+		if distance := bits.OnesCount64(entry.fingerprint ^ fingerprint); distance < best {
+			best = distance
+			match = &NearDuplicate{Url: entry.url, Similarity: similarity(distance)}
+		}
+	}
+
+	switch i, ok := x.byUrl[pageURL]; {
+	case ok:
+		x.entries[i].fingerprint = fingerprint
+	case len(x.entries) < x.maxEntries:
+		x.byUrl[pageURL] = len(x.entries)
+		x.entries = append(x.entries, fingerprintEntry{pageURL, fingerprint})
+	default:
+		delete(x.byUrl, x.entries[x.next].url)
+		x.entries[x.next] = fingerprintEntry{pageURL, fingerprint}
+		x.byUrl[pageURL] = x.next
+		x.next = (x.next + 1) % x.maxEntries
+	}
+
+	return match
+}
+
+// fingerprintResult fingerprints a successful result's content and flags it
+// when index already holds a near-duplicate.
+func fingerprintResult(index *FingerprintIndex, result *ScrapeResult) {
+	result.Fingerprint, result.DuplicateOf = "", nil
+	if result.Error != "" {
+		return
+	}
+	fingerprint, ok := SimHash(result.Content)
+	if !ok {
+		return
+	}
+	result.Fingerprint = formatFingerprint(fingerprint)
+	result.DuplicateOf = index.Add(result.Url, fingerprint)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"math/bits"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// articleText returns n words of deterministic filler text.
+func articleText(seed int64, n int) string {
+	vocabulary := strings.Fields("search index crawler sitemap page content link anchor title heading paragraph mirror print view archive robots fetch parse token embed vector host domain query result")
+	r := rand.New(rand.NewSource(seed))
+	words := make([]string, n)
+	for i := range words {
+		words[i] = vocabulary[r.Intn(len(vocabulary))]
+	}
+	return strings.Join(words, " ")
+}
+
+func TestSimHashSeparatesNearAndDistinctText(t *testing.T) {
+	original := articleText(1, 400)
+	edited := strings.Replace(original, " ", " Extra, ", 1)
+	distinct := articleText(2, 400)
+
+	a, ok := SimHash(original)
+	if !ok {
+		t.Fatal("Expected a fingerprint for a long text")
+	}
+	b, _ := SimHash(edited)
+	c, _ := SimHash(distinct)
+
+	if d := bits.OnesCount64(a ^ b); d > DefaultNearDuplicateDistance {
+		t.Errorf("A one word edit moved the fingerprint %d bits", d)
+	}
+	if d := bits.OnesCount64(a ^ c); d <= DefaultNearDuplicateDistance {
+		t.Errorf("Distinct texts are only %d bits apart", d)
+	}
+	if again, _ := SimHash(strings.ToUpper(original)); again != a {
+		t.Error("Fingerprints should ignore case")
+	}
+	if _, ok := SimHash("too short to judge"); ok {
+		t.Error("Short content should not be fingerprinted")
+	}
+}
+
+func TestFingerprintIndexFlagsClosestEarlierPage(t *testing.T) {
+	index := NewFingerprintIndex(2, 3)
+
+	if match := index.Add("https://example.com/a", 0b0000); match != nil {
+		t.Fatalf("First page cannot be a duplicate, got %+v", match)
+	}
+	if match := index.Add("https://example.com/far", 0xffff); match != nil {
+		t.Fatalf("Distant page should not match, got %+v", match)
+	}
+	match := index.Add("https://example.com/print", 0b0011)
+	if match == nil || match.Url != "https://example.com/a" || match.Similarity != 1-2.0/64 {
+		t.Fatalf("Expected a near-duplicate of /a, got %+v", match)
+	}
+	// The index holds two entries, /a was replaced by /print.
+	if match := index.Add("https://example.com/b", 0b0000); match == nil || match.Url != "https://example.com/print" {
+		t.Errorf("Expected the oldest entry to be evicted, got %+v", match)
+	}
+	// Scraping a page again does not match the page itself.
+	if match := index.Add("https://example.com/far", 0xffff); match != nil {
+		t.Errorf("A page should not duplicate itself, got %+v", match)
+	}
+}
+
+func TestScrapeSitesFlagsNearDuplicates(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	urls := []string{server.URL + "/article", server.URL + "/article/print", server.URL + "/other"}
+	content := articleText(3, 300)
+
+	saved := fingerprints
+	fingerprints = NewFingerprintIndex(maxFingerprints, DefaultNearDuplicateDistance)
+	t.Cleanup(func() { fingerprints = saved })
+
+	results, err := ScrapeSitesWith(context.Background(), stubScraper{
+		urls[0]: {SchemaVersion: ScrapeSchemaVersion, Url: urls[0], Content: content},
+		urls[1]: {SchemaVersion: ScrapeSchemaVersion, Url: urls[1], Content: "Print view\n" + content},
+		urls[2]: {SchemaVersion: ScrapeSchemaVersion, Url: urls[2], Content: articleText(4, 300)},
+	}, urls, fastScrapeOptions)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	for i, result := range results {
+		if len(result.Fingerprint) != 16 {
+			t.Errorf("Result %d should carry a fingerprint, got %q", i, result.Fingerprint)
+		}
+	}
+	if results[0].DuplicateOf != nil || results[2].DuplicateOf != nil {
+		t.Errorf("Distinct pages should not be flagged, got %+v and %+v", results[0].DuplicateOf, results[2].DuplicateOf)
+	}
+	if dup := results[1].DuplicateOf; dup == nil || dup.Url != urls[0] || dup.Similarity < 1-float64(DefaultNearDuplicateDistance)/64 {
+		t.Errorf("Print view should be flagged as a near-duplicate of the article, got %+v", dup)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// w3cLayouts are the W3C Datetime profile (https://www.w3.org/TR/NOTE-datetime)
+// that sitemap lastmod values must follow. Fractional seconds are optional.
+var w3cLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// w3cZonelessLayouts are not valid W3C Datetime, but plenty of sitemaps leave
+// the timezone off so they are accepted as UTC.
+var w3cZonelessLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+}
+
+// parseW3CDatetime parses a sitemap lastmod value. zoneless reports that the
+// value carried a time but no timezone designator and was read as UTC.
+func parseW3CDatetime(value string) (t time.Time, zoneless bool, err error) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range w3cLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, false, nil
+		}
+	}
+	for _, layout := range w3cZonelessLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true, nil
+		}
+	}
+
+	return time.Time{}, false, fmt.Errorf("invalid W3C datetime %q", value)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MaxSitemapUrls is the most URLs the sitemap protocol allows in one document.
+const MaxSitemapUrls = 50000
+
+var rssDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+}
+
+// parseTextSitemap reads a plain-text sitemap, one absolute URL per line.
+// Anything that is not an http(s) URL is skipped.
+func parseTextSitemap(sitemapData []byte) UrlSet {
+	var urlSet UrlSet
+
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(sitemapData, []byte("\xef\xbb\xbf"))))
+	for scanner.Scan() && len(urlSet.URL) < MaxSitemapUrls {
+		line := strings.TrimSpace(scanner.Text())
+		if isAbsoluteHTTPURL(line) {
+			urlSet.URL = append(urlSet.URL, SitemapUrl{Loc: line})
+		}
+	}
+
+	return urlSet
+}
+
+// toUrlSet turns an Atom feed into a UrlSet so feeds can stand in for a sitemap.
+// Lastmod is taken from updated, or published when there is no update.
+func (atom AtomFeed) toUrlSet() UrlSet {
+	var urlSet UrlSet
+	for _, entry := range atom.Entries {
+		lastmod := entry.Updated
+		if lastmod == "" {
+			lastmod = entry.Published
+		}
+		if loc := atomEntryLink(entry); loc != "" {
+			urlSet.URL = append(urlSet.URL, SitemapUrl{Loc: loc, Lastmod: lastmod})
+		}
+	}
+	return urlSet
+}
+
+func (rss RssFeed) toUrlSet() UrlSet {
+	var urlSet UrlSet
+	for _, item := range append(rss.Items, rss.RdfItem...) {
+		loc := strings.TrimSpace(item.Link)
+		if loc == "" && isAbsoluteHTTPURL(strings.TrimSpace(item.Guid)) {
+			loc = strings.TrimSpace(item.Guid)
+		}
+		if loc == "" {
+			continue
+		}
+
+		lastmod := item.Date
+		if item.PubDate != "" {
+			lastmod = rssDateToW3C(item.PubDate)
+		}
+		urlSet.URL = append(urlSet.URL, SitemapUrl{Loc: loc, Lastmod: lastmod})
+	}
+	return urlSet
+}
+
+// atomEntryLink returns the entry's alternate link, a link without rel counts
+// as alternate per RFC 4287.
+func atomEntryLink(entry AtomEntry) string {
+	for _, link := range entry.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	return ""
+}
+
+// rssDateToW3C converts an RFC 822 pubDate to the W3C Datetime format used by
+// sitemap lastmod, leaving it untouched when it cannot be parsed.
+func rssDateToW3C(pubDate string) string {
+	pubDate = strings.TrimSpace(pubDate)
+	for _, layout := range rssDateLayouts {
+		if t, err := time.Parse(layout, pubDate); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return pubDate
+}
+
+func isAbsoluteHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
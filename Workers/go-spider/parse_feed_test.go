@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseSitemapPlainText(t *testing.T) {
+	data := []byte("\xef\xbb\xbfhttps://example.com/a\r\n\nnot a url\nftp://example.com/file\n  https://example.com/b  \n")
+
+	sitemap, err := ParseSitemap("https://example.com/sitemap.txt", data)
+	if err != nil {
+		t.Fatalf("ParseSitemap failed: %v", err)
+	}
+
+	urls := sitemap.UrlSet.URL
+	if len(urls) != 2 || urls[0].Loc != "https://example.com/a" || urls[1].Loc != "https://example.com/b" {
+		t.Errorf("Unexpected text sitemap urls: %+v", urls)
+	}
+}
+
+func TestParseSitemapRSS(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Blog</title>
+<item><title>First</title><link>https://blog.example.com/first</link><pubDate>Tue, 10 Jun 2025 04:00:00 GMT</pubDate></item>
+<item><title>Guid only</title><guid isPermaLink="true">https://blog.example.com/second</guid></item>
+</channel></rss>`)
+
+	sitemap, err := ParseSitemap("https://blog.example.com/rss.xml", data)
+	if err != nil {
+		t.Fatalf("ParseSitemap failed: %v", err)
+	}
+
+	urls := sitemap.UrlSet.URL
+	if len(urls) != 2 {
+		t.Fatalf("Expected 2 feed urls, got %d", len(urls))
+	}
+	if urls[0].Loc != "https://blog.example.com/first" || urls[0].Lastmod != "2025-06-10T04:00:00Z" {
+		t.Errorf("Unexpected first item: %+v", urls[0])
+	}
+	if urls[1].Loc != "https://blog.example.com/second" {
+		t.Errorf("Expected guid permalink as loc, got %q", urls[1].Loc)
+	}
+}
+
+func TestParseSitemapAtom(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+<entry><link rel="edit" href="https://blog.example.com/edit/1"/><link href="https://blog.example.com/post-1"/><updated>2025-06-10T04:00:00Z</updated></entry>
+<entry><link rel="alternate" href="https://blog.example.com/post-2"/><published>2025-05-01T00:00:00Z</published></entry>
+</feed>`)
+
+	sitemap, err := ParseSitemap("https://blog.example.com/atom.xml", data)
+	if err != nil {
+		t.Fatalf("ParseSitemap failed: %v", err)
+	}
+
+	urls := sitemap.UrlSet.URL
+	if len(urls) != 2 {
+		t.Fatalf("Expected 2 feed urls, got %d", len(urls))
+	}
+	if urls[0].Loc != "https://blog.example.com/post-1" || urls[0].Lastmod != "2025-06-10T04:00:00Z" {
+		t.Errorf("Unexpected first entry: %+v", urls[0])
+	}
+	if urls[1].Loc != "https://blog.example.com/post-2" || urls[1].Lastmod != "2025-05-01T00:00:00Z" {
+		t.Errorf("Unexpected second entry: %+v", urls[1])
+	}
+
+	backend := TransformToBackendModel(sitemap)
+	if len(backend.UrlSet) != 2 || backend.UrlSet[0].Location != "https://blog.example.com/post-1" {
+		t.Errorf("Feed did not transform to backend model: %+v", backend.UrlSet)
+	}
+}
+
+func TestMapSiteFallsBackToFeed(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/rss.xml": `<rss version="2.0"><channel><item><link>{{host}}/post</link></item></channel></rss>`,
+	})
+
+	site, err := MapSite(context.Background(), server.URL, DefaultSitemapDepth)
+	if err != nil {
+		t.Fatalf("MapSite failed: %v", err)
+	}
+	if len(site.SitemapIndex) != 1 || len(site.SitemapIndex[0].UrlSet) != 1 {
+		t.Fatalf("Expected feed to be mapped, got %+v", site.SitemapIndex)
+	}
+}
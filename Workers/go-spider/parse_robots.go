@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseRobots parses a robots.txt document following RFC 9309. Consecutive
+// user-agent lines share one group, rules outside any group are ignored and
+// Sitemap lines are collected regardless of where they appear.
+func ParseRobots(data []byte) *Robots {
+	robots := &Robots{}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var group *RobotsGroup
+	lastWasAgent := false
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if group == nil || !lastWasAgent {
+				robots.Groups = append(robots.Groups, RobotsGroup{})
+				group = &robots.Groups[len(robots.Groups)-1]
+			}
+			group.UserAgents = append(group.UserAgents, strings.ToLower(productToken(value)))
+			lastWasAgent = true
+		case "allow", "disallow":
+			lastWasAgent = false
+			// An empty rule matches nothing, "Disallow:" on its own allows everything.
+			if group == nil || value == "" {
+				continue
+			}
+			group.Rules = append(group.Rules, RobotsRule{Allow: key == "allow", Path: normalizeRobotsPath(value)})
+		case "crawl-delay":
+			lastWasAgent = false
+			if group == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+				group.CrawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			if value != "" {
+				robots.Sitemaps = append(robots.Sitemaps, value)
+			}
+		}
+	}
+
+	return robots
+}
+
+// Allowed reports whether userAgent may fetch rawURL. The longest matching rule
+// wins and Allow beats Disallow on a tie. A nil Robots allows everything.
+func (r *Robots) Allowed(userAgent, rawURL string) bool {
+	if r == nil {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.DisallowAll {
+		return false
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	path = normalizeRobotsPath(path)
+
+	allowed := true
+	matchLength := -1
+	for _, group := range r.groupsFor(userAgent) {
+		for _, rule := range group.Rules {
+			if !matchRobotsPattern(rule.Path, path) {
+				continue
+			}
+			if len(rule.Path) > matchLength || (len(rule.Path) == matchLength && rule.Allow) {
+				allowed = rule.Allow
+				matchLength = len(rule.Path)
+			}
+		}
+	}
+
+	return allowed
+}
+
+// CrawlDelay returns the Crawl-delay that applies to userAgent, or zero when the
+// site does not set one.
+func (r *Robots) CrawlDelay(userAgent string) time.Duration {
+	if r == nil {
+		return 0
+	}
+
+	var delay time.Duration
+	for _, group := range r.groupsFor(userAgent) {
+		if group.CrawlDelay > delay {
+			delay = group.CrawlDelay
+		}
+	}
+	return delay
+}
+
+// groupsFor returns every group naming the crawler's product token, falling back
+// to the "*" groups when none do.
+func (r *Robots) groupsFor(userAgent string) []RobotsGroup {
+	token := strings.ToLower(productToken(userAgent))
+
+	var matched, wildcard []RobotsGroup
+	for _, group := range r.Groups {
+		switch {
+		case slices.Contains(group.UserAgents, token):
+			matched = append(matched, group)
+		case slices.Contains(group.UserAgents, "*"):
+			wildcard = append(wildcard, group)
+		}
+	}
+
+	if len(matched) > 0 {
+		return matched
+	}
+	return wildcard
+}
+
+// productToken strips the version and comments from a user agent, so that
+// "PortfolioSpider/1.0 (+https://...)" is matched as "PortfolioSpider".
+func productToken(userAgent string) string {
+	token := strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(token, "/ ("); i >= 0 {
+		token = token[:i]
+	}
+	return token
+}
+
+// matchRobotsPattern matches path against a rule where "*" matches any run of
+// characters and a trailing "$" anchors the rule to the end of the path.
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+
+	if len(parts) == 1 {
+		return !anchored || pos == len(path)
+	}
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(path[pos:], part)
+		if i < 0 {
+			return false
+		}
+		pos += i + len(part)
+	}
+
+	last := parts[len(parts)-1]
+	if anchored {
+		return len(path)-pos >= len(last) && strings.HasSuffix(path, last)
+	}
+	return strings.Contains(path[pos:], last)
+}
+
+// normalizeRobotsPath percent-encodes non-ASCII bytes and upper-cases existing
+// escapes so rules and URLs are compared in the same form.
+func normalizeRobotsPath(path string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '%' && i+2 < len(path) && isHex(path[i+1]) && isHex(path[i+2]):
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(path[i+1 : i+3]))
+			i += 2
+		case c >= 0x80 || c <= 0x20:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0f])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const sampleRobots = "\xef\xbb\xbf# comment\n" +
+	"User-agent: *\n" +
+	"Disallow: /private\n" +
+	"Allow: /private/public\n" +
+	"Disallow: /*.pdf$\n" +
+	"Disallow: /search*q=\n" +
+	"\n" +
+	"User-agent: PortfolioSpider\n" +
+	"User-agent: OtherBot\n" +
+	"Disallow: /tmp/ # trailing comment\n" +
+	"Allow: /tmp/ok\n" +
+	"Crawl-delay: 2.5\n" +
+	"Sitemap: https://example.com/sitemap.xml\n" +
+	"Disallow: /page$\n" +
+	"\n" +
+	"user-agent: portfoliospider\n" +
+	"disallow: /merged\n"
+
+func TestRobotsAllowed(t *testing.T) {
+	robots := ParseRobots([]byte(sampleRobots))
+
+	tests := []struct {
+		userAgent string
+		url       string
+		allowed   bool
+	}{
+		{"SomeBot", "https://example.com/", true},
+		{"SomeBot", "https://example.com/private/page", false},
+		{"SomeBot", "https://example.com/private/public/page", true},
+		{"SomeBot", "https://example.com/docs/file.pdf", false},
+		{"SomeBot", "https://example.com/docs/file.pdf?download=1", true},
+		{"SomeBot", "https://example.com/search?lang=en&q=go", false},
+		{"SomeBot", "https://example.com/robots.txt", true},
+		{"PortfolioSpider/1.0", "https://example.com/private/page", true},
+		{"PortfolioSpider/1.0", "https://example.com/tmp/file", false},
+		{"PortfolioSpider/1.0", "https://example.com/tmp/ok", true},
+		{"PortfolioSpider/1.0", "https://example.com/page", false},
+		{"PortfolioSpider/1.0", "https://example.com/page/2", true},
+		{"PortfolioSpider/1.0", "https://example.com/merged/x", false},
+		{"otherbot", "https://example.com/tmp/file", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.userAgent+" "+tt.url, func(t *testing.T) {
+			if got := robots.Allowed(tt.userAgent, tt.url); got != tt.allowed {
+				t.Errorf("Allowed() = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRobotsAllowWinsTie(t *testing.T) {
+	robots := ParseRobots([]byte("User-agent: *\nDisallow: /page\nAllow: /page\n"))
+
+	if !robots.Allowed("SomeBot", "https://example.com/page") {
+		t.Error("Allow should win when rules match with equal length")
+	}
+}
+
+func TestRobotsPercentEncoding(t *testing.T) {
+	robots := ParseRobots([]byte("User-agent: *\nDisallow: /café\nDisallow: /a%3cd\n"))
+
+	if robots.Allowed("SomeBot", "https://example.com/caf%C3%A9/menu") {
+		t.Error("Encoded URL should match unencoded rule")
+	}
+	if robots.Allowed("SomeBot", "https://example.com/a%3Cd") {
+		t.Error("Escape case should not matter")
+	}
+}
+
+func TestRobotsCrawlDelayAndSitemaps(t *testing.T) {
+	robots := ParseRobots([]byte(sampleRobots))
+
+	if delay := robots.CrawlDelay("PortfolioSpider/1.0"); delay != 2500*time.Millisecond {
+		t.Errorf("Expected 2.5s crawl delay, got %v", delay)
+	}
+	if delay := robots.CrawlDelay("SomeBot"); delay != 0 {
+		t.Errorf("Expected no crawl delay for wildcard group, got %v", delay)
+	}
+	if len(robots.Sitemaps) != 1 || robots.Sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("Unexpected sitemaps: %v", robots.Sitemaps)
+	}
+}
+
+func TestNilRobotsAllowsEverything(t *testing.T) {
+	var robots *Robots
+	if !robots.Allowed("SomeBot", "https://example.com/anything") {
+		t.Error("Nil robots should allow everything")
+	}
+}
+
+func TestScrapeSitesReportsDisallowed(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/robots.txt": "User-agent: *\nDisallow: /\n",
+	})
+
+	results, err := ScrapeSites(context.Background(), []string{server.URL + "/page"})
+	if err != nil {
+		t.Fatalf("ScrapeSites failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != StatusDisallowed {
+		t.Errorf("Expected disallowed status, got %v", results)
+	}
+}
+
+func TestMapSiteSkipsDisallowedSitemaps(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/robots.txt": "User-agent: *\nDisallow: /private\n" +
+			"Sitemap: {{host}}/pages.xml\nSitemap: {{host}}/private/sitemap.xml\n",
+		"/pages.xml":           urlSetDoc("/about"),
+		"/private/sitemap.xml": urlSetDoc("/secret"),
+	})
+
+	site, err := MapSite(context.Background(), server.URL, DefaultSitemapDepth)
+	if err != nil {
+		t.Fatalf("MapSite failed: %v", err)
+	}
+	private := site.SitemapIndex[1]
+	if private.IsMapped || private.Status != StatusDisallowed {
+		t.Errorf("Disallowed sitemap should not be fetched: mapped=%v status=%q", private.IsMapped, private.Status)
+	}
+}
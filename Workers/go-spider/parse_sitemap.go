@@ -3,21 +3,161 @@ package main
 import (
 	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	// ErrNotASitemap means the document parsed but is not a urlset, sitemap
+	// index or feed, typically an HTML page served in place of a sitemap.
+	ErrNotASitemap = errors.New("not a sitemap")
+	// ErrMalformedXML means the document claims to be XML but is broken or
+	// truncated.
+	ErrMalformedXML = errors.New("malformed XML")
 )
 
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// SitemapParseError reports why a document could not be parsed and where. Err
+// is ErrNotASitemap or ErrMalformedXML, so callers can match it with errors.Is.
+type SitemapParseError struct {
+	URL    string
+	Err    error
+	Detail string
+	// Line and Offset locate the problem in the uncompressed document, Offset
+	// counts bytes from its start.
+	Line   int
+	Offset int64
+}
+
+func (e *SitemapParseError) Error() string {
+	location := e.URL
+	if location == "" {
+		location = "sitemap"
+	}
+	return fmt.Sprintf("%s: %v at line %d, offset %d: %s", location, e.Err, e.Line, e.Offset, e.Detail)
+}
+
+func (e *SitemapParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseSitemap decodes a sitemap by dispatching on its root element: urlset,
+// sitemapindex, rss, RDF or feed. Bodies that are not XML are read as plain-text
+// sitemaps. Anything else fails with a SitemapParseError.
 func ParseSitemap(sitemapURL string, sitemapData []byte) (Sitemap, error) {
 	sitemap := Sitemap{Hostname: sitemapURL}
 
-	decoder := xml.NewDecoder(bytes.NewReader(sitemapData))
-	decoder.Strict = false
-	if err := decoder.Decode(&sitemap.SiteIndex); err == nil && len(sitemap.SiteIndex.Sitemap) > 0 {
-		fmt.Println("Sitemap index parsed from sitemap")
+	if !looksLikeXML(sitemapData) {
+		sitemap.UrlSet = parseTextSitemap(sitemapData)
+		if len(sitemap.UrlSet.URL) == 0 {
+			detail := "document is empty"
+			if len(bytes.TrimSpace(sitemapData)) > 0 {
+				detail = "document is neither XML nor a list of URLs"
+			}
+			return sitemap, &SitemapParseError{URL: sitemapURL, Err: ErrNotASitemap, Detail: detail, Line: 1}
+		}
+		fmt.Printf("Text sitemap found with %d\n", len(sitemap.UrlSet.URL))
+		return sitemap, nil
 	}
 
-	if err := decoder.Decode(&sitemap.UrlSet); err == nil && len(sitemap.UrlSet.URL) > 0 {
-		fmt.Printf("URL Set found with %d\n", len(sitemap.UrlSet.URL))
+	decoder := newSitemapDecoder(sitemapData)
+	root, rootErr := sitemapRoot(decoder)
+	if rootErr != nil {
+		rootErr.URL = sitemapURL
+		return sitemap, rootErr
+	}
+
+	var err error
+	switch root.Name.Local {
+	case "sitemapindex":
+		if err = decoder.DecodeElement(&sitemap.SiteIndex, &root); err == nil {
+			fmt.Println("Sitemap index parsed from sitemap")
+		}
+	case "urlset":
+		if err = decoder.DecodeElement(&sitemap.UrlSet, &root); err == nil {
+			fmt.Printf("URL Set found with %d\n", len(sitemap.UrlSet.URL))
+		}
+	case "feed":
+		var atom AtomFeed
+		if err = decoder.DecodeElement(&atom, &root); err == nil {
+			sitemap.UrlSet = atom.toUrlSet()
+			fmt.Printf("Feed found with %d\n", len(sitemap.UrlSet.URL))
+		}
+	case "rss", "RDF":
+		var rss RssFeed
+		if err = decoder.DecodeElement(&rss, &root); err == nil {
+			sitemap.UrlSet = rss.toUrlSet()
+			fmt.Printf("Feed found with %d\n", len(sitemap.UrlSet.URL))
+		}
+	}
+	if err != nil {
+		return Sitemap{Hostname: sitemapURL}, malformedXML(sitemapURL, decoder, err)
 	}
 
 	return sitemap, nil
 }
+
+// sitemapRoot reads up to the root element, past the XML declaration,
+// stylesheet processing instructions, comments and a doctype, and fails unless
+// it is one of the elements ParseSitemap and StreamSitemap understand.
+func sitemapRoot(decoder *xml.Decoder) (xml.StartElement, *SitemapParseError) {
+	for {
+		line, _ := decoder.InputPos()
+		offset := decoder.InputOffset()
+
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return xml.StartElement{}, &SitemapParseError{Err: ErrNotASitemap, Detail: "document has no root element", Line: line, Offset: offset}
+		}
+		if err != nil {
+			return xml.StartElement{}, malformedXML("", decoder, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "urlset", "sitemapindex", "rss", "RDF", "feed":
+			return start, nil
+		}
+		return start, &SitemapParseError{
+			Err:    ErrNotASitemap,
+			Detail: fmt.Sprintf("root element is <%s>, expected urlset, sitemapindex or a feed", start.Name.Local),
+			Line:   line,
+			Offset: offset,
+		}
+	}
+}
+
+func malformedXML(sitemapURL string, decoder *xml.Decoder, err error) *SitemapParseError {
+	line, _ := decoder.InputPos()
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line = syntaxErr.Line
+		err = errors.New(syntaxErr.Msg)
+	}
+	return &SitemapParseError{
+		URL:    sitemapURL,
+		Err:    ErrMalformedXML,
+		Detail: err.Error(),
+		Line:   line,
+		Offset: decoder.InputOffset(),
+	}
+}
+
+func newSitemapDecoder(sitemapData []byte) *xml.Decoder {
+	return newSitemapStreamDecoder(bytes.NewReader(bytes.TrimPrefix(sitemapData, utf8BOM)))
+}
+
+func newSitemapStreamDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	// Sitemaps declared as ISO-8859-1 or windows-1252 are still common.
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder
+}
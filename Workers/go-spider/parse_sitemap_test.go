@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseSitemapSkipsPrologue(t *testing.T) {
+	data := []byte("\xef\xbb\xbf<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+		"<?xml-stylesheet type=\"text/xsl\" href=\"/sitemap.xsl\"?>\n" +
+		"<!-- generated by a plugin -->\n" +
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>https://example.com/a</loc></url></urlset>`)
+
+	sitemap, err := ParseSitemap("https://example.com/sitemap.xml", data)
+	if err != nil {
+		t.Fatalf("ParseSitemap failed: %v", err)
+	}
+	if len(sitemap.UrlSet.URL) != 1 || sitemap.UrlSet.URL[0].Loc != "https://example.com/a" {
+		t.Errorf("Unexpected urls %+v", sitemap.UrlSet.URL)
+	}
+}
+
+func TestParseSitemapDecodesLatin1(t *testing.T) {
+	// "Café" and "Straße" in ISO-8859-1, as many older CMS plugins still emit.
+	data := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">` +
+		"<url><loc>https://example.com/caf\xe9</loc><image:image><image:loc>https://example.com/a.jpg</image:loc><image:title>Stra\xdfe</image:title></image:image></url></urlset>")
+
+	sitemap, err := ParseSitemap("https://example.com/sitemap.xml", data)
+	if err != nil {
+		t.Fatalf("ParseSitemap failed: %v", err)
+	}
+	if len(sitemap.UrlSet.URL) != 1 || sitemap.UrlSet.URL[0].Loc != "https://example.com/café" {
+		t.Fatalf("Unexpected urls %+v", sitemap.UrlSet.URL)
+	}
+	if images := sitemap.UrlSet.URL[0].Image; len(images) != 1 || images[0].Title != "Straße" {
+		t.Errorf("Unexpected images %+v", images)
+	}
+
+	var streamed []string
+	err = StreamSitemap(bytes.NewReader(data), SitemapHandler{
+		OnUrl: func(entry SitemapUrl) error {
+			streamed = append(streamed, entry.Loc)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("StreamSitemap failed: %v", err)
+	}
+	if len(streamed) != 1 || streamed[0] != "https://example.com/café" {
+		t.Errorf("Unexpected streamed urls %q", streamed)
+	}
+}
+
+func TestParseSitemapErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+		line int
+	}{
+		{"empty", "", ErrNotASitemap, 1},
+		{"html", "<!DOCTYPE html>\n<html><body>Not found</body></html>", ErrNotASitemap, 2},
+		{"json", `{"error": "not found"}`, ErrNotASitemap, 1},
+		{"prologue only", `<?xml version="1.0"?><!-- nothing -->`, ErrNotASitemap, 1},
+		{"truncated", "<urlset>\n<url><loc>https://example.com/a</loc></url>\n<url><loc>https://exa", ErrMalformedXML, 3},
+		{"broken tag", "<sitemapindex>\n<sitemap>\n<loc>https://example.com/a.xml</>\n</sitemap>\n</sitemapindex>", ErrMalformedXML, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSitemap("https://example.com/sitemap.xml", []byte(tt.data))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			var parseErr *SitemapParseError
+			if !errors.As(err, &parseErr) || parseErr.Line != tt.line || parseErr.URL != "https://example.com/sitemap.xml" {
+				t.Errorf("Expected error at line %d, got %+v", tt.line, parseErr)
+			}
+		})
+	}
+}
+
+func TestMapRequestReportsBrokenSitemaps(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    string
+		status int
+	}{
+		{"html page", "<html><body>Page not found</body></html>", http.StatusUnprocessableEntity},
+		{"truncated", "<urlset><url><loc>https://example.com/a", http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSitemapServer(t, map[string]string{
+				"/robots.txt":  "Sitemap: {{host}}/sitemap.xml\n",
+				"/sitemap.xml": tt.doc,
+			})
+
+			rec := httptest.NewRecorder()
+			mapRequestHandler(rec, httptest.NewRequest(http.MethodGet, "/map?url="+server.URL, nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
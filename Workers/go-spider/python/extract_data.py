@@ -1,6 +1,19 @@
-from bs4 import BeautifulSoup
+import json
+from urllib.parse import urldefrag, urljoin, urlparse
+
+from bs4 import BeautifulSoup, CData, NavigableString, Tag
+
+HEADING_TAGS = ('h1', 'h2', 'h3', 'h4', 'h5', 'h6')
+
 
 def extract_main_content(html):
+    return extract_main_content_with_headings(html)[0]
+
+
+def extract_main_content_with_headings(html):
+    """Return the main content one line per text node, and its headings with
+    the character offset where each one's section starts, in the shape of
+    ContentHeading in chunk_content.go."""
     soup = BeautifulSoup(html, 'html.parser')
 
     # Remove all script and style tags
@@ -26,17 +39,183 @@ def extract_main_content(html):
     if not main_content:
         main_content = soup.find('body') or soup
 
-    text = main_content.get_text(separator='\n', strip=True)
-    lines = [line.strip() for line in text.split('\n') if line.strip()]
+    # Walk the strings like get_text(separator='\n', strip=True) would, noting
+    # where each heading's section starts along the way.
+    lines, headings = [], []
+    for node in main_content.descendants:
+        if isinstance(node, Tag) and node.name in HEADING_TAGS:
+            text = ' '.join(node.get_text(' ').split())
+            if text:
+                headings.append((int(node.name[1]), text, len(lines)))
+        elif type(node) in (NavigableString, CData):
+            lines.extend(line.strip() for line in node.strip().split('\n')
+                         if is_content_line(line.strip()))
+
+    content = '\n'.join(lines)
+    # Offsets in characters, like ContentHeading in chunk_content.go.
+    line_starts = [0]
+    for line in lines:
+        line_starts.append(line_starts[-1] + len(line) + 1)
+    return content, [{'level': level, 'text': text, 'offset': min(line_starts[line], len(content))}
+                     for level, text, line in headings]
+
+
+def is_content_line(line):
+    # Filter out empty lines and CSS/JS patterns
+    return (len(line) > 5
+            and not line.startswith(('@', 'function', 'var ', 'const ', 'let ', 'if (', 'for ('))
+            and '--' not in line  # CSS variables
+            and '::' not in line  # CSS pseudo-elements
+            and '{' not in line[:10]  # CSS blocks
+            and 'px' not in line[-3:]  # CSS units
+            )
+
+
+def resolve_urls(html, page_url, refs):
+    """Resolve refs against page_url or the page's <base href> and keep the
+    unique http(s) ones without their fragment, like appendResolved in
+    extract_content.go. Anything else would fail validation on the Go side."""
+    soup = BeautifulSoup(html, 'html.parser')
+    base = soup.find('base', href=True)
+    if base:
+        page_url = urljoin(page_url, base['href'].strip())
+
+    urls, seen = [], set()
+    for ref in refs or []:
+        ref = str(ref or '').strip()
+        if not ref:
+            continue
+        try:
+            resolved = urldefrag(urljoin(page_url, ref)).url
+            parsed = urlparse(resolved)
+        except ValueError:
+            continue
+        if parsed.scheme not in ('http', 'https') or not parsed.netloc or resolved in seen:
+            continue
+        seen.add(resolved)
+        urls.append(resolved)
+    return urls
+
+
+def extract_canonical(html, page_url):
+    """Return the page's <link rel="canonical"> resolved against page_url or
+    its <base href>, or an empty string. The Go side canonicalizes it."""
+    soup = BeautifulSoup(html, 'html.parser')
+    base = soup.find('base', href=True)
+    if base:
+        page_url = urljoin(page_url, base['href'].strip())
+    link = soup.find('link', rel='canonical', href=True)
+    if not link:
+        return ""
+    return urljoin(page_url, link['href'].strip())
+
+
+OPEN_GRAPH_NAMESPACES = ('og:', 'article:', 'book:', 'profile:', 'product:', 'music:', 'video:')
+MICRODATA_URL_ATTRS = {
+    'audio': 'src', 'embed': 'src', 'iframe': 'src', 'img': 'src', 'source': 'src',
+    'track': 'src', 'video': 'src', 'a': 'href', 'area': 'href', 'link': 'href',
+    'object': 'data',
+}
+
+
+def extract_structured_data(html, page_url):
+    """Return JSON-LD, microdata, OpenGraph and Twitter card data in the shape
+    of StructuredData in structured_data.go, or None when the page has none."""
+    soup = BeautifulSoup(html, 'html.parser')
+    base = soup.find('base', href=True)
+    if base:
+        page_url = urljoin(page_url, base['href'].strip())
+
+    json_ld = []
+    for script in soup.find_all('script'):
+        if (script.get('type') or '').strip().lower() == 'application/ld+json':
+            json_ld.extend(_parse_json_ld(script.string or script.get_text()))
+
+    open_graph, twitter = {}, {}
+    for meta in soup.find_all('meta'):
+        content = (meta.get('content') or '').strip()
+        if not content:
+            continue
+        for key in (meta.get('property'), meta.get('name')):
+            key = (key or '').strip().lower()
+            if key.startswith('twitter:') and len(key) > len('twitter:'):
+                twitter.setdefault(key[len('twitter:'):], content)
+                break
+            if any(key.startswith(ns) and len(key) > len(ns) for ns in OPEN_GRAPH_NAMESPACES):
+                key = key[len('og:'):] if key.startswith('og:') else key
+                open_graph.setdefault(key, []).append(content)
+                break
+
+    microdata = [_microdata_item(tag, page_url)
+                 for tag in soup.find_all(attrs={'itemscope': True})
+                 if not tag.has_attr('itemprop')]
+
+    data = {'jsonLd': json_ld, 'microdata': microdata, 'openGraph': open_graph, 'twitter': twitter}
+    data = {key: value for key, value in data.items() if value}
+    return data or None
+
+
+def _parse_json_ld(script):
+    script = (script or '').strip()
+    for start, end in (('<!--', '-->'), ('<![CDATA[', ']]>'), ('//<![CDATA[', '//]]>')):
+        if script.startswith(start) and script.endswith(end):
+            script = script[len(start):len(script) - len(end)].strip()
+    try:
+        value = json.loads(script)
+    except ValueError:
+        return []
+    return _flatten_json_ld(value, None)
+
+
+def _flatten_json_ld(value, context):
+    if isinstance(value, list):
+        return [obj for item in value for obj in _flatten_json_ld(item, context)]
+    if not isinstance(value, dict):
+        return []
+    context = value.get('@context', context)
+    if '@graph' in value:
+        return _flatten_json_ld(value['@graph'], context)
+    if '@context' not in value and context is not None:
+        value['@context'] = context
+    return [value]
+
+
+def _microdata_item(tag, page_url):
+    item = {'properties': {}}
+    item_type = (tag.get('itemtype') or '')
+    if isinstance(item_type, list):
+        item_type = ' '.join(item_type)
+    if item_type.split():
+        item['type'] = item_type.split()
+    if (tag.get('itemid') or '').strip():
+        item['id'] = tag['itemid'].strip()
+
+    def collect(parent):
+        for child in parent.find_all(True, recursive=False):
+            names = child.get('itemprop') or ''
+            if isinstance(names, list):
+                names = ' '.join(names)
+            if names.split():
+                value = _microdata_value(child, page_url)
+                for name in names.split():
+                    item['properties'].setdefault(name, []).append(value)
+            if not child.has_attr('itemscope'):
+                collect(child)
+
+    collect(tag)
+    return item
 
-    # Filter out CSS/JS patterns
-    lines = [line for line in lines
-             if len(line) > 5
-             and not line.startswith(('@', 'function', 'var ', 'const ', 'let ', 'if (', 'for ('))
-             and '--' not in line  # CSS variables
-             and '::' not in line  # CSS pseudo-elements
-             and '{' not in line[:10]  # CSS blocks
-             and 'px' not in line[-3:]  # CSS units
-             ]
 
-    return '\n'.join(lines)
\ No newline at end of file
+def _microdata_value(tag, page_url):
+    if tag.has_attr('itemscope'):
+        return _microdata_item(tag, page_url)
+    if tag.name == 'meta':
+        return (tag.get('content') or '').strip()
+    if tag.name in MICRODATA_URL_ATTRS:
+        ref = (tag.get(MICRODATA_URL_ATTRS[tag.name]) or '').strip()
+        return urljoin(page_url, ref) if ref else ref
+    if tag.name in ('data', 'meter'):
+        return (tag.get('value') or '').strip()
+    if tag.name == 'time' and tag.get('datetime'):
+        return tag['datetime'].strip()
+    return ' '.join(tag.get_text(' ').split())
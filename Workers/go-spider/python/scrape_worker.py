@@ -0,0 +1,34 @@
+"""Long-lived scraper worker driven by the Go PythonPool.
+
+Reads one JSON request per line on stdin and writes one JSON response per line
+on stdout:
+
+    {"id": 1, "url": "https://example.com"} -> {"id": 1, "result": {...}}
+    {"id": 2, "ping": true}                  -> {"id": 2, "pong": true}
+
+The worker exits when stdin is closed.
+"""
+import json
+import sys
+
+# Anything a library prints must not end up in the protocol stream.
+protocol = sys.stdout
+sys.stdout = sys.stderr
+
+from stealth_scrape import scrape  # noqa: E402  (imported after redirecting stdout)
+
+
+def respond(message):
+    protocol.write(json.dumps(message) + "\n")
+    protocol.flush()
+
+
+for line in sys.stdin:
+    line = line.strip()
+    if not line:
+        continue
+    request = json.loads(line)
+    if request.get("ping"):
+        respond({"id": request["id"], "pong": True})
+        continue
+    respond({"id": request["id"], "result": scrape(request["url"])})
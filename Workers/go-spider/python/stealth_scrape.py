@@ -1,24 +1,89 @@
 import json
 import sys
+import time
 import stealth_requests
-from extract_data import extract_main_content
+from extract_data import extract_canonical, extract_main_content_with_headings, extract_structured_data, resolve_urls
 
-urls = json.loads(sys.argv[1])
-results = []
+# Must match ScrapeSchemaVersion in scrape_result.go, the Go side rejects
+# results written against another version.
+SCHEMA_VERSION = 1
 
-for url in urls:
+
+def as_text(value):
+    if value is None:
+        return ""
+    if isinstance(value, (list, tuple)):
+        return ", ".join(str(v) for v in value)
+    return str(value)
+
+
+def redirect_hop(hop):
+    """One entry of resp.history as a Redirect in fetch_metadata.go, or None.
+    Depending on the version, history holds dicts or response objects."""
+    if isinstance(hop, dict):
+        url, status = hop.get("url"), hop.get("status_code") or hop.get("code")
+    else:
+        url, status = getattr(hop, "url", None), getattr(hop, "status_code", None)
+    if not url:
+        return None
+    return {"url": str(url), "statusCode": int(status or 0)}
+
+
+def fetch_info(resp, started):
+    """Fetch metadata in the shape of FetchInfo in fetch_metadata.go. Only the
+    total time is measured here, the other phases are left out rather than
+    reported as zero."""
+    timing = {"totalMs": (time.perf_counter() - started) * 1000}
+    if resp is None:
+        return {"timing": timing}
+
+    headers = getattr(resp, "headers", None) or {}
+    redirects = [hop for hop in map(redirect_hop, getattr(resp, "history", None) or []) if hop]
+    info = {
+        "statusCode": int(getattr(resp, "status_code", 0) or 0),
+        "finalUrl": str(getattr(resp, "url", "") or ""),
+        "redirects": redirects,
+        "contentType": headers.get("content-type", ""),
+        "lastModified": headers.get("last-modified", ""),
+        "etag": headers.get("etag", ""),
+        "xRobotsTag": headers.get("x-robots-tag", ""),
+        "bodySize": len(getattr(resp, "content", b"") or b""),
+    }
+    info = {key: value for key, value in info.items() if value}
+    info["timing"] = timing
+    return info
+
+
+def scrape(url):
+    started = time.perf_counter()
+    resp = None
     try:
         resp = stealth_requests.get(url)
-        data = {
+        # Same rule as the native scraper: only a 200 is a page.
+        status = int(getattr(resp, "status_code", 0) or 0)
+        if status and status != 200:
+            raise Exception(f"status code {status}")
+        html = getattr(resp, "text", "") or ""
+        final_url = str(getattr(resp, "url", "") or url)
+        content, headings = extract_main_content_with_headings(resp.text_content())
+        return {
+            "schemaVersion": SCHEMA_VERSION,
             "url": url,
-            "links": resp.links,
-            "title": resp.meta.title,
-            "description": resp.meta.description,
-            "content": extract_main_content(resp.text_content()),
-            "images": resp.images,
-            "keywords": resp.meta.keywords,
+            "links": resolve_urls(html, final_url, resp.links),
+            "title": as_text(resp.meta.title),
+            "description": as_text(resp.meta.description),
+            "content": content,
+            "headings": headings,
+            "images": resolve_urls(html, final_url, resp.images),
+            "keywords": as_text(resp.meta.keywords),
+            "canonical": extract_canonical(html, final_url),
+            "structured": extract_structured_data(html, final_url),
+            "fetch": fetch_info(resp, started),
         }
-        results.append(data)
     except Exception as e:
-        results.append({"url": url, "error": str(e)})
-print(json.dumps(results))
\ No newline at end of file
+        return {"schemaVersion": SCHEMA_VERSION, "url": url, "error": str(e), "fetch": fetch_info(resp, started)}
+
+
+if __name__ == "__main__":
+    urls = json.loads(sys.argv[1])
+    print(json.dumps([scrape(url) for url in urls]))
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkerScript = "python/scrape_worker.py"
+
+	// DefaultWorkerMaxJobs is how many pages a worker scrapes before it is
+	// replaced, which caps the memory any leak in the Python libraries can take.
+	DefaultWorkerMaxJobs = 200
+	// DefaultWorkerJobTimeout bounds one page, a worker that takes longer is
+	// assumed stuck and killed.
+	DefaultWorkerJobTimeout = 90 * time.Second
+
+	// A worker idle for longer than workerHealthInterval is pinged before it
+	// gets another job.
+	workerHealthInterval = 30 * time.Second
+	workerPingTimeout    = 5 * time.Second
+	workerStopTimeout    = 5 * time.Second
+)
+
+var errWorkerExited = errors.New("python worker exited")
+
+var (
+	sharedPoolOnce sync.Once
+	sharedPool     *PythonPool
+)
+
+// sharedPythonPool returns the process-wide pool, sized by PYTHON_WORKERS and
+// PYTHON_WORKER_MAX_JOBS. Workers start on first use.
+func sharedPythonPool() *PythonPool {
+	sharedPoolOnce.Do(func() {
+		size := DefaultScrapeConcurrency
+		if n, err := strconv.Atoi(getEnv("PYTHON_WORKERS", "")); err == nil && n > 0 {
+			size = n
+		}
+		maxJobs := DefaultWorkerMaxJobs
+		if n, err := strconv.Atoi(getEnv("PYTHON_WORKER_MAX_JOBS", "")); err == nil && n > 0 {
+			maxJobs = n
+		}
+		sharedPool = NewPythonPool(defaultPythonPath, []string{defaultWorkerScript}, size, maxJobs)
+	})
+	return sharedPool
+}
+
+// PythonPool is a Scraper backed by long-lived python/scrape_worker.py
+// processes speaking newline delimited JSON on stdin and stdout, one request
+// and one response per URL. A caller waits when every worker is busy, crashed
+// or stuck workers are replaced, and each worker is recycled after MaxJobs. A
+// worker whose caller gives up mid-job is killed, like exec.CommandContext would.
+type PythonPool struct {
+	Command    string
+	Args       []string
+	MaxJobs    int
+	JobTimeout time.Duration
+
+	// slots holds one entry per worker, taking one is how a caller waits for a
+	// free worker.
+	slots chan *workerSlot
+}
+
+type workerSlot struct {
+	proc *workerProcess // nil until started, or after it was stopped
+}
+
+type workerProcess struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses chan workerResponse
+	exited    chan struct{}
+
+	nextID   int
+	jobs     int
+	lastUsed time.Time
+}
+
+type workerRequest struct {
+	ID   int    `json:"id"`
+	URL  string `json:"url,omitempty"`
+	Ping bool   `json:"ping,omitempty"`
+}
+
+type workerResponse struct {
+	ID     int             `json:"id"`
+	Pong   bool            `json:"pong,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+func NewPythonPool(command string, args []string, size, maxJobs int) *PythonPool {
+	pool := &PythonPool{
+		Command:    command,
+		Args:       args,
+		MaxJobs:    maxJobs,
+		JobTimeout: DefaultWorkerJobTimeout,
+		slots:      make(chan *workerSlot, size),
+	}
+	for i := 0; i < size; i++ {
+		pool.slots <- &workerSlot{}
+	}
+	return pool
+}
+
+func (p *PythonPool) Scrape(ctx context.Context, urls []string) ([]ScrapeResult, error) {
+	results := make([]ScrapeResult, 0, len(urls))
+	for _, url := range urls {
+		result, err := p.scrapeURL(ctx, url)
+		if err != nil {
+			fmt.Printf("Python worker failed on %s: %v\n", url, err)
+			result = failedScrape(url, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (p *PythonPool) scrapeURL(ctx context.Context, url string) (ScrapeResult, error) {
+	var slot *workerSlot
+	select {
+	case slot = <-p.slots:
+	case <-ctx.Done():
+		return ScrapeResult{}, ctx.Err()
+	}
+	defer func() { p.slots <- slot }()
+
+	if err := p.ready(ctx, slot); err != nil {
+		return ScrapeResult{}, err
+	}
+
+	resp, err := slot.proc.call(ctx, workerRequest{URL: url}, p.JobTimeout)
+	if err != nil {
+		// A worker that crashed, timed out or was abandoned mid-job is in an
+		// unknown state.
+		slot.stop(true)
+		return ScrapeResult{}, err
+	}
+
+	slot.proc.jobs++
+	if p.MaxJobs > 0 && slot.proc.jobs >= p.MaxJobs {
+		slot.stop(false)
+	}
+
+	var result ScrapeResult
+	if err := decodeStrict(resp.Result, &result); err != nil {
+		return ScrapeResult{}, fmt.Errorf("decode worker result failed: %w", err)
+	}
+	// An error page the worker extracted is not a page, the same as for the
+	// native scraper.
+	if fetch := result.Fetch; result.Error == "" && fetch != nil && fetch.StatusCode != 0 {
+		if err := pageStatusError(fetch.StatusCode); err != nil {
+			result = failedScrape(url, err)
+			result.Fetch = fetch
+		}
+	}
+	return result, nil
+}
+
+// ready makes sure slot has a live, responsive worker, replacing one that
+// exited or fails its health check. When ctx ends during the check the worker
+// is kept and ctx's error returned.
+func (p *PythonPool) ready(ctx context.Context, slot *workerSlot) error {
+	if proc := slot.proc; proc != nil {
+		select {
+		case <-proc.exited:
+			fmt.Println("Python worker exited, restarting")
+			slot.stop(true)
+		default:
+			if time.Since(proc.lastUsed) > workerHealthInterval {
+				if _, err := proc.call(ctx, workerRequest{Ping: true}, workerPingTimeout); err != nil {
+					// A caller that gave up says nothing about the worker, its
+					// late pong is skipped by the next call.
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						return ctxErr
+					}
+					fmt.Printf("Python worker failed health check, restarting: %v\n", err)
+					slot.stop(true)
+				}
+			}
+		}
+	}
+
+	if slot.proc == nil {
+		proc, err := startWorker(p.Command, p.Args)
+		if err != nil {
+			return fmt.Errorf("start python worker failed: %w", err)
+		}
+		slot.proc = proc
+	}
+	return nil
+}
+
+// Close stops every worker once it is free. The pool stays usable, workers are
+// started again on demand.
+func (p *PythonPool) Close() {
+	slots := make([]*workerSlot, 0, cap(p.slots))
+	for i := 0; i < cap(p.slots); i++ {
+		slot := <-p.slots
+		slot.stop(false)
+		slots = append(slots, slot)
+	}
+	for _, slot := range slots {
+		p.slots <- slot
+	}
+}
+
+func startWorker(command string, args []string) (*workerProcess, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	proc := &workerProcess{
+		cmd:       cmd,
+		stdin:     stdin,
+		responses: make(chan workerResponse),
+		exited:    make(chan struct{}),
+		lastUsed:  time.Now(),
+	}
+
+	go func() {
+		defer close(proc.exited)
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				var resp workerResponse
+				if jsonErr := json.Unmarshal(line, &resp); jsonErr != nil {
+					fmt.Printf("Python worker wrote invalid JSON: %v\n", jsonErr)
+					continue
+				}
+				select {
+				case proc.responses <- resp:
+				case <-time.After(workerStopTimeout):
+					// Nobody is waiting, the call it answers already timed out.
+				}
+			}
+			if err != nil {
+				cmd.Wait()
+				return
+			}
+		}
+	}()
+
+	return proc, nil
+}
+
+// call sends one request and waits for its response, for at most timeout and
+// no longer than ctx lasts.
+func (w *workerProcess) call(ctx context.Context, req workerRequest, timeout time.Duration) (workerResponse, error) {
+	w.nextID++
+	req.ID = w.nextID
+	w.lastUsed = time.Now()
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return workerResponse{}, err
+	}
+	if _, err := w.stdin.Write(append(line, '\n')); err != nil {
+		return workerResponse{}, fmt.Errorf("write to python worker failed: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case resp := <-w.responses:
+			if resp.ID != req.ID {
+				continue
+			}
+			return resp, nil
+		case <-w.exited:
+			return workerResponse{}, errWorkerExited
+		case <-timer.C:
+			return workerResponse{}, fmt.Errorf("python worker did not answer within %v: %w", timeout, context.DeadlineExceeded)
+		case <-ctx.Done():
+			return workerResponse{}, ctx.Err()
+		}
+	}
+}
+
+// stop ends the slot's worker and leaves the slot empty for a fresh one. A
+// healthy worker is asked to exit by closing its stdin and only killed if it
+// does not, a broken one is killed right away.
+func (s *workerSlot) stop(kill bool) {
+	proc := s.proc
+	if proc == nil {
+		return
+	}
+	s.proc = nil
+
+	proc.stdin.Close()
+	if !kill {
+		select {
+		case <-proc.exited:
+			return
+		case <-time.After(workerStopTimeout):
+		}
+	}
+	proc.cmd.Process.Kill()
+	<-proc.exited
+}
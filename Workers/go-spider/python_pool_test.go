@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPythonWorkerHelper is not a real test: the pool tests start the test
+// binary itself as a stand-in for python/scrape_worker.py. It answers every
+// request with its pid as the title, extracts a 404 page on /missing, reports
+// the fetch of /old in the shape python/stealth_scrape.py writes it, crashes on
+// /crash, never answers /hang and stops answering pings after /deaf.
+func TestPythonWorkerHelper(t *testing.T) {
+	if os.Getenv("GO_PYTHON_WORKER_HELPER") == "" {
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	deaf := false
+	for scanner.Scan() {
+		var req workerRequest
+		json.Unmarshal(scanner.Bytes(), &req)
+
+		switch {
+		case req.Ping:
+			if !deaf {
+				encoder.Encode(workerResponse{ID: req.ID, Pong: true})
+			}
+		case strings.HasSuffix(req.URL, "/missing"):
+			result, _ := json.Marshal(ScrapeResult{SchemaVersion: ScrapeSchemaVersion, Url: req.URL, Title: "Page not found", Fetch: &FetchInfo{StatusCode: http.StatusNotFound}})
+			encoder.Encode(workerResponse{ID: req.ID, Result: result})
+		case strings.HasSuffix(req.URL, "/old"):
+			base := strings.TrimSuffix(req.URL, "/old")
+			result := fmt.Sprintf(`{"schemaVersion": %d, "url": %q, "title": "Final", "fetch": {"statusCode": 200, "finalUrl": "%s/final", "redirects": [{"url": "%s/old", "statusCode": 301}, {"url": "%s/moved", "statusCode": 302}], "contentType": "text/html", "bodySize": 3, "timing": {"totalMs": 12.5}}}`,
+				ScrapeSchemaVersion, req.URL, base, base, base)
+			encoder.Encode(workerResponse{ID: req.ID, Result: json.RawMessage(result)})
+		case strings.HasSuffix(req.URL, "/crash"):
+			os.Exit(1)
+		case strings.HasSuffix(req.URL, "/hang"):
+			continue
+		default:
+			deaf = deaf || strings.HasSuffix(req.URL, "/deaf")
+			result, _ := json.Marshal(ScrapeResult{SchemaVersion: ScrapeSchemaVersion, Url: req.URL, Title: strconv.Itoa(os.Getpid())})
+			encoder.Encode(workerResponse{ID: req.ID, Result: result})
+		}
+	}
+	os.Exit(0)
+}
+
+func newHelperPool(t *testing.T, size, maxJobs int) *PythonPool {
+	t.Helper()
+	t.Setenv("GO_PYTHON_WORKER_HELPER", "1")
+	pool := NewPythonPool(os.Args[0], []string{"-test.run=^TestPythonWorkerHelper$"}, size, maxJobs)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func scrapeTitles(t *testing.T, pool *PythonPool, urls ...string) []string {
+	t.Helper()
+	results, err := pool.Scrape(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	var titles []string
+	for i, result := range results {
+		if result.Url != urls[i] {
+			t.Fatalf("Result %d is for %s, want %s", i, result.Url, urls[i])
+		}
+		titles = append(titles, result.Title)
+	}
+	return titles
+}
+
+func TestPythonPoolReusesAndRecyclesWorkers(t *testing.T) {
+	pool := newHelperPool(t, 1, 2)
+
+	pids := scrapeTitles(t, pool, "https://example.com/1", "https://example.com/2", "https://example.com/3", "https://example.com/4", "https://example.com/5")
+
+	if pids[0] == "" || pids[0] != pids[1] || pids[2] != pids[3] {
+		t.Errorf("A worker should serve 2 jobs before it is recycled, got pids %v", pids)
+	}
+	if pids[1] == pids[2] || pids[3] == pids[4] {
+		t.Errorf("A worker should be replaced after 2 jobs, got pids %v", pids)
+	}
+}
+
+func TestPythonPoolRestartsCrashedWorkers(t *testing.T) {
+	pool := newHelperPool(t, 1, 0)
+	pool.JobTimeout = 200 * time.Millisecond
+
+	results, _ := pool.Scrape(context.Background(), []string{"https://example.com/a", "https://example.com/crash", "https://example.com/hang", "https://example.com/b"})
+
+	if results[0].Error != "" || results[3].Error != "" {
+		t.Fatalf("Healthy jobs should succeed, got %+v and %+v", results[0], results[3])
+	}
+	if results[1].Error == "" || results[2].Error == "" {
+		t.Errorf("Crashed and stuck jobs should fail, got %+v and %+v", results[1], results[2])
+	}
+	if results[0].Title == results[3].Title {
+		t.Error("The crashed worker should have been replaced")
+	}
+
+	// A worker that dies while idle is noticed before its next job.
+	slot := <-pool.slots
+	slot.proc.cmd.Process.Kill()
+	<-slot.proc.exited
+	pool.slots <- slot
+
+	if titles := scrapeTitles(t, pool, "https://example.com/c"); titles[0] == "" || titles[0] == results[3].Title {
+		t.Errorf("Expected a fresh worker after the idle one died, got %v", titles)
+	}
+}
+
+func TestPythonPoolFailsNonOKPagesLikeNative(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", map[string]string{})
+	native, _ := NewNativeScraper().Scrape(context.Background(), []string{server.URL + "/missing"})
+
+	pool := newHelperPool(t, 1, 0)
+	results, _ := pool.Scrape(context.Background(), []string{"https://example.com/missing"})
+
+	got, want := results[0], native[0]
+	if got.Error == "" || got.Error != want.Error || got.Status != want.Status {
+		t.Errorf("Python result should fail like the native one with %q, got %+v", want.Error, got)
+	}
+	if got.Title != "" || got.Fetch == nil || got.Fetch.StatusCode != want.Fetch.StatusCode {
+		t.Errorf("Python result should keep only the fetch metadata, got %+v", got)
+	}
+}
+
+func TestPythonPoolDecodesWorkerFetchInfo(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Final</title></head></html>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	native, _ := NewNativeScraper().Scrape(context.Background(), []string{server.URL + "/old"})
+
+	pool := newHelperPool(t, 1, 0)
+	results, _ := pool.Scrape(context.Background(), []string{server.URL + "/old"})
+
+	got, want := results[0].Fetch, native[0].Fetch
+	if got == nil || got.FinalUrl != want.FinalUrl || len(got.Redirects) != len(want.Redirects) {
+		t.Fatalf("Worker fetch should end at %s after %v, got %+v", want.FinalUrl, want.Redirects, got)
+	}
+	for i, hop := range want.Redirects {
+		if got.Redirects[i] != hop {
+			t.Errorf("Redirect %d: expected %v, got %v", i, hop, got.Redirects[i])
+		}
+	}
+	timing := got.Timing
+	if timing.DNS != nil || timing.Connect != nil || timing.TLS != nil || timing.TTFB != nil || timing.Total != 12.5 {
+		t.Errorf("Only the total time is measured by the worker, got %+v", timing)
+	}
+}
+
+func TestPythonPoolAppliesBackpressure(t *testing.T) {
+	pool := newHelperPool(t, 2, 0)
+
+	var mu sync.Mutex
+	pids := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, _ := pool.Scrape(context.Background(), []string{"https://example.com/" + strconv.Itoa(i)})
+			mu.Lock()
+			pids[results[0].Title] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(pids) > 2 || pids[""] {
+		t.Errorf("Expected 8 jobs to share 2 workers, got pids %v", pids)
+	}
+}
+
+func TestPythonPoolKillsAbandonedWorker(t *testing.T) {
+	pool := newHelperPool(t, 1, 0)
+
+	before := scrapeTitles(t, pool, "https://example.com/a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results, _ := pool.Scrape(ctx, []string{"https://example.com/hang"})
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Scrape should stop at the deadline, took %v", elapsed)
+	}
+	if results[0].Status != StatusTimeout {
+		t.Errorf("Abandoned job should time out, got %+v", results[0])
+	}
+	if after := scrapeTitles(t, pool, "https://example.com/b"); after[0] == "" || after[0] == before[0] {
+		t.Errorf("The abandoned worker should have been replaced, got pids %v then %v", before, after)
+	}
+}
+
+func TestPythonPoolKeepsWorkerWhenCallerGivesUpOnHealthCheck(t *testing.T) {
+	pool := newHelperPool(t, 1, 0)
+
+	before := scrapeTitles(t, pool, "https://example.com/deaf")
+
+	slot := <-pool.slots
+	slot.proc.lastUsed = time.Now().Add(-2 * workerHealthInterval)
+	proc := slot.proc
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := pool.ready(ctx, slot)
+	pool.slots <- slot
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the caller's deadline, got %v", err)
+	}
+	if slot.proc != proc {
+		t.Error("The worker should be kept when the caller gives up")
+	}
+	if after := scrapeTitles(t, pool, "https://example.com/b"); after[0] != before[0] {
+		t.Errorf("The same worker should serve the next job, got pids %v then %v", before, after)
+	}
+}
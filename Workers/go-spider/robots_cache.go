@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RobotsCacheTTL is how long a fetched robots.txt is reused, the upper bound
+	// RFC 9309 recommends.
+	RobotsCacheTTL = 24 * time.Hour
+	// RobotsErrorTTL is how long a host stays fully disallowed after its
+	// robots.txt failed with a server error or could not be reached.
+	RobotsErrorTTL = 30 * time.Minute
+
+	maxRobotsSize      = 500 * 1024
+	maxRobotsRedirects = 5
+	maxRobotsEntries   = 10000
+)
+
+var errTooManyRobotsRedirects = errors.New("too many robots.txt redirects")
+
+// robotsCache is shared by discovery, mapping and scraping so that every host
+// costs at most one robots.txt fetch per TTL.
+var robotsCache = NewRobotsCache(RobotsCacheTTL, RobotsErrorTTL)
+
+type RobotsCache struct {
+	client     *http.Client
+	ttl        time.Duration
+	errorTTL   time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	ready    chan struct{}
+	robots   *Robots
+	expires  time.Time
+	lastUsed time.Time
+	// abandoned is set when the fetch was cut short by its caller's ctx, the
+	// callers waiting on it fetch again rather than share that result.
+	abandoned bool
+}
+
+func NewRobotsCache(ttl, errorTTL time.Duration) *RobotsCache {
+	return &RobotsCache{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRobotsRedirects {
+					return errTooManyRobotsRedirects
+				}
+				return nil
+			},
+		},
+		ttl:        ttl,
+		errorTTL:   errorTTL,
+		maxEntries: maxRobotsEntries,
+		entries:    make(map[string]*robotsEntry),
+	}
+}
+
+// robotsFor returns the robots rules for the host serving rawURL, or nil when
+// rawURL has no host to ask.
+func robotsFor(ctx context.Context, rawURL string) *Robots {
+	return robotsCache.Get(ctx, rawURL)
+}
+
+// Get returns the robots rules for the origin of rawURL, fetching them when they
+// are missing or expired. Concurrent callers for the same origin wait for a
+// single fetch instead of each issuing their own. A full cache makes room by
+// dropping expired entries, or else the least recently used one.
+//
+// When ctx ends first Get disallows everything, callers check ctx to tell that
+// apart from a host that disallows them. Nothing is cached for a fetch that
+// ctx cut short.
+func (c *RobotsCache) Get(ctx context.Context, rawURL string) *Robots {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	for {
+		now := time.Now()
+
+		c.mu.Lock()
+		entry, ok := c.entries[origin]
+		if ok && entry.expired(now) {
+			ok = false
+		}
+		if !ok {
+			if len(c.entries) >= c.maxEntries {
+				c.evictExpired(now)
+			}
+			if len(c.entries) >= c.maxEntries {
+				c.evictLeastRecentlyUsed()
+			}
+			entry = &robotsEntry{ready: make(chan struct{}), lastUsed: now}
+			c.entries[origin] = entry
+			c.mu.Unlock()
+
+			robots, ttl := c.fetch(ctx, origin)
+			if ctx.Err() != nil {
+				c.mu.Lock()
+				if c.entries[origin] == entry {
+					delete(c.entries, origin)
+				}
+				c.mu.Unlock()
+				entry.abandoned = true
+				close(entry.ready)
+				return &Robots{DisallowAll: true}
+			}
+			entry.robots = robots
+			entry.expires = time.Now().Add(ttl)
+			close(entry.ready)
+			return robots
+		}
+		entry.lastUsed = now
+		c.mu.Unlock()
+
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			return &Robots{DisallowAll: true}
+		}
+		if !entry.abandoned {
+			return entry.robots
+		}
+	}
+}
+
+// evictExpired drops stale entries, callers must hold c.mu.
+func (c *RobotsCache) evictExpired(now time.Time) {
+	for origin, entry := range c.entries {
+		if entry.expired(now) {
+			delete(c.entries, origin)
+		}
+	}
+}
+
+// evictLeastRecentlyUsed drops the fetched entry used longest ago, callers
+// must hold c.mu. Entries still being fetched are kept for their waiters.
+func (c *RobotsCache) evictLeastRecentlyUsed() {
+	var oldest string
+	var oldestUsed time.Time
+	for origin, entry := range c.entries {
+		select {
+		case <-entry.ready:
+		default:
+			continue
+		}
+		if oldest == "" || entry.lastUsed.Before(oldestUsed) {
+			oldest, oldestUsed = origin, entry.lastUsed
+		}
+	}
+	if oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
+
+func (e *robotsEntry) expired(now time.Time) bool {
+	select {
+	case <-e.ready:
+		return now.After(e.expires)
+	default:
+		// Still being fetched, the caller waits for it.
+		return false
+	}
+}
+
+// fetch downloads robots.txt for origin and applies the RFC 9309 failure rules:
+// a missing file (4xx) allows everything, a server error or unreachable host
+// disallows everything for errorTTL.
+func (c *RobotsCache) fetch(ctx context.Context, origin string) (*Robots, time.Duration) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return &Robots{}, c.ttl
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if errors.Is(err, errTooManyRobotsRedirects) {
+			fmt.Printf("Robots for %s redirected more than %d times, allowing all\n", origin, maxRobotsRedirects)
+			return &Robots{}, c.ttl
+		}
+		fmt.Printf("Robots fetch failed for %s, disallowing all: %v\n", origin, err)
+		return &Robots{DisallowAll: true}, c.errorTTL
+	}
+	defer resp.Body.Close()
+
+	switch {
+	// 429 is a 4xx, but it means the server is overloaded rather than the file missing.
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		fmt.Printf("Robots for %s returned %d, disallowing all\n", origin, resp.StatusCode)
+		return &Robots{DisallowAll: true}, c.errorTTL
+	case resp.StatusCode != http.StatusOK:
+		return &Robots{}, c.ttl
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		fmt.Printf("Robots read failed for %s, disallowing all: %v\n", origin, err)
+		return &Robots{DisallowAll: true}, c.errorTTL
+	}
+
+	// Soft 404s serve an HTML page with status 200, treat them as a missing file
+	// rather than parsing markup as rules.
+	if isHTMLDocument(body) {
+		return &Robots{}, c.ttl
+	}
+
+	return ParseRobots(body), c.ttl
+}
+
+func isHTMLDocument(body []byte) bool {
+	start := bytes.ToLower(bytes.TrimSpace(body[:min(len(body), 512)]))
+	return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html"))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRobotsCacheFetchesOncePerHost(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	}))
+	defer server.Close()
+
+	cache := NewRobotsCache(time.Hour, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			robots := cache.Get(context.Background(), fmt.Sprintf("%s/page-%d", server.URL, i))
+			if !robots.Allowed(UserAgent, fmt.Sprintf("%s/page-%d", server.URL, i)) {
+				t.Errorf("page-%d should be allowed", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if hits.Load() != 1 {
+		t.Errorf("Expected 1 robots fetch for 100 urls, got %d", hits.Load())
+	}
+}
+
+func TestRobotsCacheRefetchesAfterTTL(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprint(w, "User-agent: *\nDisallow:\n")
+	}))
+	defer server.Close()
+
+	cache := NewRobotsCache(time.Millisecond, time.Millisecond)
+	cache.Get(context.Background(), server.URL)
+	time.Sleep(5 * time.Millisecond)
+	cache.Get(context.Background(), server.URL)
+
+	if hits.Load() != 2 {
+		t.Errorf("Expected expired entry to be refetched, got %d fetches", hits.Load())
+	}
+}
+
+func TestRobotsCacheErrorSemantics(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		allowed bool
+	}{
+		{"not found allows all", func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}, true},
+		{"forbidden allows all", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}, true},
+		{"server error disallows all", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, false},
+		{"too many requests disallows all", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, false},
+		{"html error page allows all", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<!DOCTYPE html><html><body>Disallow: /</body></html>")
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			robots := NewRobotsCache(time.Hour, time.Minute).Get(context.Background(), server.URL)
+			if got := robots.Allowed(UserAgent, server.URL+"/page"); got != tt.allowed {
+				t.Errorf("Allowed() = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRobotsCacheUnreachableDisallowsAll(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	robots := NewRobotsCache(time.Hour, time.Minute).Get(context.Background(), url)
+	if robots.Allowed(UserAgent, url+"/page") {
+		t.Error("Unreachable host should be disallowed")
+	}
+}
+
+func TestRobotsCacheRedirects(t *testing.T) {
+	tests := []struct {
+		hops    int
+		allowed bool
+	}{
+		{hops: maxRobotsRedirects, allowed: false},
+		{hops: maxRobotsRedirects + 1, allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d hops", tt.hops), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var hop int
+				fmt.Sscanf(r.URL.Query().Get("hop"), "%d", &hop)
+				if hop < tt.hops {
+					http.Redirect(w, r, fmt.Sprintf("/moved?hop=%d", hop+1), http.StatusFound)
+					return
+				}
+				fmt.Fprint(w, "User-agent: *\nDisallow: /\n")
+			}))
+			defer server.Close()
+
+			robots := NewRobotsCache(time.Hour, time.Minute).Get(context.Background(), server.URL)
+			if got := robots.Allowed(UserAgent, server.URL+"/page"); got != tt.allowed {
+				t.Errorf("Allowed() = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRobotsCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	var servers []*httptest.Server
+	hits := make([]atomic.Int32, 3)
+	for i := range hits {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i].Add(1)
+			fmt.Fprint(w, "User-agent: *\nDisallow:\n")
+		}))
+		defer server.Close()
+		servers = append(servers, server)
+	}
+
+	cache := NewRobotsCache(time.Hour, time.Minute)
+	cache.maxEntries = 2
+	cache.Get(context.Background(), servers[0].URL)
+	time.Sleep(time.Millisecond)
+	cache.Get(context.Background(), servers[1].URL)
+	time.Sleep(time.Millisecond)
+	// Using the first host again makes the second the least recently used.
+	cache.Get(context.Background(), servers[0].URL)
+	time.Sleep(time.Millisecond)
+	cache.Get(context.Background(), servers[2].URL)
+
+	if n := len(cache.entries); n != 2 {
+		t.Fatalf("Expected the cache to stay at 2 entries while all are fresh, got %d", n)
+	}
+	cache.Get(context.Background(), servers[0].URL)
+	cache.Get(context.Background(), servers[1].URL)
+	if hits[0].Load() != 1 || hits[1].Load() != 2 {
+		t.Errorf("Expected only the least recently used host to be refetched, got %d and %d fetches", hits[0].Load(), hits[1].Load())
+	}
+}
+
+func TestRobotsCacheDoesNotKeepCanceledFetch(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, "User-agent: *\nDisallow:\n")
+	}))
+	defer server.Close()
+
+	cache := NewRobotsCache(time.Hour, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	if robots := cache.Get(ctx, server.URL); robots.Allowed(UserAgent, server.URL+"/page") {
+		t.Error("A fetch cut short should not allow anything")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Get should return when ctx ends, took %s", elapsed)
+	}
+
+	if robots := cache.Get(context.Background(), server.URL); !robots.Allowed(UserAgent, server.URL+"/page") {
+		t.Error("The next caller should fetch robots.txt again instead of reusing the canceled fetch")
+	}
+}
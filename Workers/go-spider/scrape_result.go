@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"unicode/utf8"
+)
+
+// ScrapeSchemaVersion is bumped whenever a field of ScrapeResult changes
+// meaning or is removed, so the backend can tell which contract it is reading.
+// Scrapers must report the version they were written against.
+const ScrapeSchemaVersion = 1
+
+// ScrapeResult is the result for one URL of a /scrape request, the contract
+// shared with the backend's DTOScraperResult. A failed page only carries its
+// Url, Error and, when it was never fetched or ran out of time, Status.
+//
+// Url is the URL as the caller sent it, CanonicalUrl the canonical form that
+// was actually scraped, filled in by ScrapeSitesWith. Canonical is what the
+// page itself declares with rel=canonical.
+type ScrapeResult struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	Url           string      `json:"url"`
+	Status        FetchStatus `json:"status,omitempty"`
+	Title         string      `json:"title,omitempty"`
+	Description   string      `json:"description,omitempty"`
+	Keywords      string      `json:"keywords,omitempty"`
+	Content       string      `json:"content,omitempty"`
+	Links         []string    `json:"links,omitempty"`
+	Images        []string    `json:"images,omitempty"`
+	CanonicalUrl  string      `json:"canonicalUrl,omitempty"`
+	Canonical     string      `json:"canonical,omitempty"`
+	Error         string      `json:"error,omitempty"`
+
+	// Structured is the page's JSON-LD, microdata, OpenGraph and Twitter card
+	// data, nil when it has none.
+	Structured *StructuredData `json:"structured,omitempty"`
+
+	// Headings are the headings of Content. Chunks splits Content for the
+	// embedding pipeline and is filled in by ScrapeSitesWith, not the scrapers.
+	Headings []ContentHeading `json:"headings,omitempty"`
+	Chunks   []ContentChunk   `json:"chunks,omitempty"`
+
+	// Fetch is how the page was fetched, present whenever a request was made,
+	// also on failed results.
+	Fetch *FetchInfo `json:"fetch,omitempty"`
+
+	// Fingerprint is the SimHash of Content as 16 hex digits, DuplicateOf the
+	// recently scraped page it nearly duplicates. Both are filled in by
+	// ScrapeSitesWith, not by the scrapers.
+	Fingerprint string         `json:"fingerprint,omitempty"`
+	DuplicateOf *NearDuplicate `json:"duplicateOf,omitempty"`
+}
+
+// failedScrape reports a page that could not be scraped, with StatusTimeout
+// when it failed because a deadline passed.
+func failedScrape(url string, err error) ScrapeResult {
+	result := ScrapeResult{SchemaVersion: ScrapeSchemaVersion, Url: url, Error: err.Error()}
+	if isTimeout(err) {
+		result.Status = StatusTimeout
+	}
+	return result
+}
+
+// isTimeout reports whether err comes from a passed deadline, either a context
+// deadline or a network timeout such as http.Client.Timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// dropInvalidUrls removes the links and images that are not absolute http(s)
+// URLs, such as mailto: links or data: images, and a canonical that is not
+// one, returning how many were dropped. A few unusable URLs are no reason to
+// throw away the page.
+func (r *ScrapeResult) dropInvalidUrls() int {
+	dropped := 0
+	keep := func(urls []string) []string {
+		var kept []string
+		for _, u := range urls {
+			if isAbsoluteHTTPURL(u) {
+				kept = append(kept, u)
+			} else {
+				dropped++
+			}
+		}
+		return kept
+	}
+	r.Links = keep(r.Links)
+	r.Images = keep(r.Images)
+	if r.Canonical != "" && !isAbsoluteHTTPURL(r.Canonical) {
+		r.Canonical = ""
+		dropped++
+	}
+	return dropped
+}
+
+// Validate checks that a result follows the current schema: the right version,
+// an absolute page URL, absolute link, image, canonical and final URLs,
+// headings that fall within the content, and no page data on a failed result.
+func (r ScrapeResult) Validate() error {
+	if r.SchemaVersion != ScrapeSchemaVersion {
+		return fmt.Errorf("schema version %d, expected %d", r.SchemaVersion, ScrapeSchemaVersion)
+	}
+	if !isAbsoluteHTTPURL(r.Url) {
+		return fmt.Errorf("url %q is not an absolute http(s) URL", r.Url)
+	}
+	if r.Error != "" && (r.Title != "" || r.Content != "" || len(r.Links) > 0 || len(r.Images) > 0 || r.Structured != nil || len(r.Headings) > 0) {
+		return errors.New("failed result carries page data")
+	}
+	contentLength := utf8.RuneCountInString(r.Content)
+	for _, heading := range r.Headings {
+		if heading.Level < 1 || heading.Level > 6 || heading.Offset < 0 || heading.Offset > contentLength {
+			return fmt.Errorf("heading %q at level %d, offset %d does not fit the content", heading.Text, heading.Level, heading.Offset)
+		}
+	}
+	for _, link := range r.Links {
+		if !isAbsoluteHTTPURL(link) {
+			return fmt.Errorf("link %q is not an absolute http(s) URL", link)
+		}
+	}
+	for _, image := range r.Images {
+		if !isAbsoluteHTTPURL(image) {
+			return fmt.Errorf("image %q is not an absolute http(s) URL", image)
+		}
+	}
+	if r.Canonical != "" && !isAbsoluteHTTPURL(r.Canonical) {
+		return fmt.Errorf("canonical %q is not an absolute http(s) URL", r.Canonical)
+	}
+	if r.Fetch != nil && r.Fetch.FinalUrl != "" && !isAbsoluteHTTPURL(r.Fetch.FinalUrl) {
+		return fmt.Errorf("final url %q is not an absolute http(s) URL", r.Fetch.FinalUrl)
+	}
+	return nil
+}
+
+// decodeStrict decodes a scraper's JSON output into v: unknown fields, wrong
+// types and trailing data are all errors, so a drifting scraper fails loudly
+// instead of silently dropping fields.
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("trailing data after result")
+	}
+	return nil
+}
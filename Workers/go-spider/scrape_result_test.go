@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDecodeScrapeResultsIsStrict(t *testing.T) {
+	tests := map[string]string{
+		"unknown field": `[{"schemaVersion": 1, "url": "https://example.com", "tittle": "Typo"}]`,
+		"wrong type":    `[{"schemaVersion": 1, "url": "https://example.com", "links": "https://example.com/a"}]`,
+		"trailing data": `[{"schemaVersion": 1, "url": "https://example.com"}] [{}]`,
+		"not a list":    `{"schemaVersion": 1, "url": "https://example.com"}`,
+	}
+	for name, output := range tests {
+		var results []ScrapeResult
+		if err := decodeStrict([]byte(output), &results); err == nil {
+			t.Errorf("%s: expected a decode error", name)
+		}
+	}
+}
+
+func TestScrapeResultValidate(t *testing.T) {
+	valid := ScrapeResult{SchemaVersion: ScrapeSchemaVersion, Url: "https://example.com", Links: []string{"https://example.com/a"}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected a valid result, got %v", err)
+	}
+
+	tests := map[string]func(*ScrapeResult){
+		"missing version": func(r *ScrapeResult) { r.SchemaVersion = 0 },
+		"relative url":    func(r *ScrapeResult) { r.Url = "/page" },
+		"relative link":   func(r *ScrapeResult) { r.Links = []string{"/a"} },
+		"bad image":       func(r *ScrapeResult) { r.Images = []string{"data:image/png;base64,AAAA"} },
+		"error with data": func(r *ScrapeResult) { r.Error = "timeout" },
+		"future version":  func(r *ScrapeResult) { r.SchemaVersion = ScrapeSchemaVersion + 1 },
+	}
+	for name, mutate := range tests {
+		result := valid
+		mutate(&result)
+		if err := result.Validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
+
+// stubScraper returns canned results by URL, a URL it has no result for gets
+// the result stored under "".
+type stubScraper map[string]ScrapeResult
+
+func (s stubScraper) Scrape(ctx context.Context, urls []string) ([]ScrapeResult, error) {
+	var results []ScrapeResult
+	for _, url := range urls {
+		result, ok := s[url]
+		if !ok {
+			result = s[""]
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// fastScrapeOptions keeps the politeness delay out of tests that don't test it.
+var fastScrapeOptions = ScrapeOptions{MaxConcurrency: 4, MaxPerHost: 4}
+
+func TestScrapeSitesRejectsMalformedResults(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	urls := []string{server.URL + "/a", server.URL + "/b", server.URL + "/c"}
+
+	results, err := ScrapeSitesWith(context.Background(), stubScraper{
+		urls[0]: {SchemaVersion: ScrapeSchemaVersion, Url: urls[0], Title: "A"},
+		urls[1]: {SchemaVersion: ScrapeSchemaVersion, Url: urls[1], Headings: []ContentHeading{{Level: 7, Text: "Deep"}}},
+		"":      {SchemaVersion: ScrapeSchemaVersion, Url: urls[0], Title: "Wrong page"},
+	}, urls, fastScrapeOptions)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	if results[0].Title != "A" || results[0].Error != "" {
+		t.Errorf("Valid result should pass through, got %+v", results[0])
+	}
+	for _, i := range []int{1, 2} {
+		if results[i].Url != urls[i] || !strings.HasPrefix(results[i].Error, "invalid scrape result") || len(results[i].Links) > 0 || results[i].Title != "" {
+			t.Errorf("Result %d should be replaced by an error, got %+v", i, results[i])
+		}
+	}
+}
+
+func TestScrapeSitesDropsUnusableUrls(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	pageURL := server.URL + "/page"
+
+	results, err := ScrapeSitesWith(context.Background(), stubScraper{
+		"": {
+			SchemaVersion: ScrapeSchemaVersion,
+			Url:           pageURL,
+			Title:         "Page",
+			Links:         []string{"mailto:someone@example.com", server.URL + "/next", "javascript:void(0)", "relative/path"},
+			Images:        []string{"data:image/png;base64,AAAA", server.URL + "/logo.png"},
+			Canonical:     "/page",
+		},
+	}, []string{pageURL}, fastScrapeOptions)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	page := results[0]
+	if page.Error != "" || page.Title != "Page" {
+		t.Fatalf("Page should be kept, got %+v", page)
+	}
+	if len(page.Links) != 1 || page.Links[0] != server.URL+"/next" {
+		t.Errorf("Expected only the http link, got %v", page.Links)
+	}
+	if len(page.Images) != 1 || page.Images[0] != server.URL+"/logo.png" {
+		t.Errorf("Expected only the http image, got %v", page.Images)
+	}
+	if page.Canonical != "" {
+		t.Errorf("Relative canonical should be dropped, got %q", page.Canonical)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultScrapeConcurrency = 8
+	DefaultHostConcurrency   = 2
+	DefaultHostDelay         = time.Second
+	DefaultURLTimeout        = 60 * time.Second
+	DefaultRequestTimeout    = 5 * time.Minute
+)
+
+type ScrapeOptions struct {
+	// MaxConcurrency caps how many pages are scraped at once across all hosts.
+	MaxConcurrency int
+	// MaxPerHost caps how many requests one host has in flight.
+	MaxPerHost int
+	// HostDelay is the minimum time between the starts of two requests to the
+	// same host. A longer robots.txt Crawl-delay takes precedence.
+	HostDelay time.Duration
+	// URLTimeout bounds the scrape of one page, counted from when it may start.
+	// Zero means no limit.
+	URLTimeout time.Duration
+	// RequestTimeout bounds the whole batch, waiting for a turn included. Pages
+	// that have not finished when it passes are reported with StatusTimeout.
+	// Zero means no limit.
+	RequestTimeout time.Duration
+	// ChunkTokens is the approximate token budget of a content chunk, zero
+	// leaves results without chunks. ChunkOverlap is how many tokens
+	// consecutive chunks of one section share.
+	ChunkTokens  int
+	ChunkOverlap int
+}
+
+// DefaultScrapeOptions returns the defaults, overridden by SCRAPE_CONCURRENCY,
+// SCRAPE_HOST_CONCURRENCY, SCRAPE_HOST_DELAY, SCRAPE_URL_TIMEOUT,
+// SCRAPE_REQUEST_TIMEOUT (durations such as 500ms or 2m), CHUNK_TOKENS and
+// CHUNK_OVERLAP_TOKENS.
+func DefaultScrapeOptions() ScrapeOptions {
+	opts := ScrapeOptions{
+		MaxConcurrency: DefaultScrapeConcurrency,
+		MaxPerHost:     DefaultHostConcurrency,
+		HostDelay:      DefaultHostDelay,
+		URLTimeout:     DefaultURLTimeout,
+		RequestTimeout: DefaultRequestTimeout,
+		ChunkTokens:    DefaultChunkTokens,
+		ChunkOverlap:   DefaultChunkOverlap,
+	}
+	if n, err := strconv.Atoi(getEnv("SCRAPE_CONCURRENCY", "")); err == nil && n > 0 {
+		opts.MaxConcurrency = n
+	}
+	if n, err := strconv.Atoi(getEnv("SCRAPE_HOST_CONCURRENCY", "")); err == nil && n > 0 {
+		opts.MaxPerHost = n
+	}
+	if d, err := time.ParseDuration(getEnv("SCRAPE_HOST_DELAY", "")); err == nil && d >= 0 {
+		opts.HostDelay = d
+	}
+	if d, err := time.ParseDuration(getEnv("SCRAPE_URL_TIMEOUT", "")); err == nil && d >= 0 {
+		opts.URLTimeout = d
+	}
+	if d, err := time.ParseDuration(getEnv("SCRAPE_REQUEST_TIMEOUT", "")); err == nil && d >= 0 {
+		opts.RequestTimeout = d
+	}
+	if n, err := strconv.Atoi(getEnv("CHUNK_TOKENS", "")); err == nil && n >= 0 {
+		opts.ChunkTokens = n
+	}
+	if n, err := strconv.Atoi(getEnv("CHUNK_OVERLAP_TOKENS", "")); err == nil && n >= 0 {
+		opts.ChunkOverlap = n
+	}
+	return opts
+}
+
+// scrapeConcurrently scrapes every URL robots.txt allows on its own, running up
+// to opts.MaxConcurrency at once while keeping each host within its
+// concurrency and delay limits, and reports the rest as disallowed. Results are
+// in the order of urls. When ctx ends first, the pages still waiting or running
+// are reported as failed, with StatusTimeout for a passed deadline, and the
+// finished ones are kept.
+func scrapeConcurrently(ctx context.Context, scraper Scraper, urls []string, opts ScrapeOptions) []ScrapeResult {
+	global := make(chan struct{}, max(opts.MaxConcurrency, 1))
+	hosts := newHostLimiter(max(opts.MaxPerHost, 1), opts.HostDelay)
+
+	type finished struct {
+		index  int
+		result ScrapeResult
+	}
+	// Buffered so a scraper that ignores ctx can still finish after we gave up on it.
+	done := make(chan finished, len(urls))
+	for i, pageURL := range urls {
+		go func() {
+			done <- finished{i, scrapeScheduled(ctx, scraper, hosts, global, pageURL, opts.URLTimeout)}
+		}()
+	}
+
+	results := make([]ScrapeResult, len(urls))
+	got := make([]bool, len(urls))
+	for remaining := len(urls); remaining > 0; remaining-- {
+		select {
+		case f := <-done:
+			results[f.index] = f.result
+			got[f.index] = true
+		case <-ctx.Done():
+			for i, pageURL := range urls {
+				if !got[i] {
+					results[i] = failedScrape(pageURL, ctx.Err())
+				}
+			}
+			return results
+		}
+	}
+	return results
+}
+
+// scrapeScheduled checks robots.txt, waits for pageURL's turn and scrapes it
+// within timeout.
+func scrapeScheduled(ctx context.Context, scraper Scraper, hosts *hostLimiter, global chan struct{}, pageURL string, timeout time.Duration) ScrapeResult {
+	robots := robotsFor(ctx, pageURL)
+	if err := ctx.Err(); err != nil {
+		return failedScrape(pageURL, err)
+	}
+	if !robots.Allowed(UserAgent, pageURL) {
+		return ScrapeResult{
+			SchemaVersion: ScrapeSchemaVersion,
+			Url:           pageURL,
+			Status:        StatusDisallowed,
+			Error:         "disallowed by robots.txt",
+		}
+	}
+
+	host, err := hosts.acquire(ctx, pageURL, global)
+	if err != nil {
+		return failedScrape(pageURL, err)
+	}
+	defer func() {
+		<-global
+		hosts.release(host)
+	}()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return scrapeOne(ctx, scraper, pageURL)
+}
+
+func scrapeOne(ctx context.Context, scraper Scraper, pageURL string) ScrapeResult {
+	scraped, err := scraper.Scrape(ctx, []string{pageURL})
+	if err != nil {
+		return failedScrape(pageURL, err)
+	}
+	if len(scraped) != 1 {
+		return failedScrape(pageURL, fmt.Errorf("scraper returned %d results for 1 url", len(scraped)))
+	}
+	return scraped[0]
+}
+
+type hostLimiter struct {
+	perHost int
+	delay   time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	slots chan struct{}
+	// turn orders the starts of requests to the host, whoever holds it is next.
+	turn sync.Mutex
+	next time.Time
+}
+
+func newHostLimiter(perHost int, delay time.Duration) *hostLimiter {
+	return &hostLimiter{perHost: perHost, delay: delay, hosts: make(map[string]*hostState)}
+}
+
+// acquire blocks until pageURL may be requested: its host has a free slot, the
+// host's delay since the previous start has passed, and a global slot is free.
+// Waiting on the delay does not hold a global slot, so other hosts keep going.
+// It gives up with ctx's error when ctx ends first.
+func (l *hostLimiter) acquire(ctx context.Context, pageURL string, global chan struct{}) (*hostState, error) {
+	host := l.stateFor(pageURL)
+	select {
+	case host.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	delay := max(l.delay, robotsFor(ctx, pageURL).CrawlDelay(UserAgent))
+
+	// Whoever holds the turn gives it up as soon as ctx ends, and every waiter
+	// shares that ctx, so the lock itself need not be cancellable.
+	host.turn.Lock()
+	defer host.turn.Unlock()
+
+	err := sleepContext(ctx, time.Until(host.next))
+	if err == nil {
+		select {
+		case global <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if err != nil {
+		l.release(host)
+		return nil, err
+	}
+	host.next = time.Now().Add(delay)
+
+	return host, nil
+}
+
+func (l *hostLimiter) release(host *hostState) {
+	<-host.slots
+}
+
+func (l *hostLimiter) stateFor(pageURL string) *hostState {
+	key := pageURL
+	if u, err := url.Parse(pageURL); err == nil {
+		key = strings.ToLower(u.Host)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	host, ok := l.hosts[key]
+	if !ok {
+		host = &hostState{slots: make(chan struct{}, l.perHost)}
+		l.hosts[key] = host
+	}
+	return host
+}
+
+// sleepContext sleeps for d, returning ctx's error early when ctx ends first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
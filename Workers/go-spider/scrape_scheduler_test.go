@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingScraper pretends to fetch each page for a while and records how many
+// requests were in flight, overall and per host, and when each host was hit.
+type recordingScraper struct {
+	duration time.Duration
+
+	mu         sync.Mutex
+	inFlight   int
+	maxGlobal  int
+	hostFlight map[string]int
+	maxPerHost map[string]int
+	starts     map[string][]time.Time
+}
+
+func newRecordingScraper(duration time.Duration) *recordingScraper {
+	return &recordingScraper{
+		duration:   duration,
+		hostFlight: make(map[string]int),
+		maxPerHost: make(map[string]int),
+		starts:     make(map[string][]time.Time),
+	}
+}
+
+func (s *recordingScraper) Scrape(ctx context.Context, urls []string) ([]ScrapeResult, error) {
+	var results []ScrapeResult
+	for _, pageURL := range urls {
+		u, _ := url.Parse(pageURL)
+
+		s.mu.Lock()
+		s.inFlight++
+		s.hostFlight[u.Host]++
+		s.maxGlobal = max(s.maxGlobal, s.inFlight)
+		s.maxPerHost[u.Host] = max(s.maxPerHost[u.Host], s.hostFlight[u.Host])
+		s.starts[u.Host] = append(s.starts[u.Host], time.Now())
+		s.mu.Unlock()
+
+		time.Sleep(s.duration)
+
+		s.mu.Lock()
+		s.inFlight--
+		s.hostFlight[u.Host]--
+		s.mu.Unlock()
+
+		results = append(results, ScrapeResult{SchemaVersion: ScrapeSchemaVersion, Url: pageURL})
+	}
+	return results, nil
+}
+
+func (s *recordingScraper) minGap(host string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	starts := append([]time.Time(nil), s.starts[host]...)
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	gap := time.Duration(1<<63 - 1)
+	for i := 1; i < len(starts); i++ {
+		gap = min(gap, starts[i].Sub(starts[i-1]))
+	}
+	return gap
+}
+
+func TestScrapeConcurrentlyLimitsAndOrder(t *testing.T) {
+	first := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	second := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+
+	var urls []string
+	for i := 0; i < 6; i++ {
+		urls = append(urls, first.URL+"/page"+string(rune('a'+i)), second.URL+"/page"+string(rune('a'+i)))
+	}
+
+	scraper := newRecordingScraper(20 * time.Millisecond)
+	results := scrapeConcurrently(context.Background(), scraper, urls, ScrapeOptions{MaxConcurrency: 3, MaxPerHost: 2})
+
+	for i, result := range results {
+		if result.Url != urls[i] {
+			t.Fatalf("Result %d is for %s, want %s", i, result.Url, urls[i])
+		}
+	}
+	if scraper.maxGlobal > 3 || scraper.maxGlobal < 2 {
+		t.Errorf("Expected up to 3 requests in flight across hosts, got %d", scraper.maxGlobal)
+	}
+	for host, peak := range scraper.maxPerHost {
+		if peak > 2 {
+			t.Errorf("Host %s had %d requests in flight, limit is 2", host, peak)
+		}
+	}
+}
+
+func TestScrapeConcurrentlySpacesRequestsPerHost(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		delay  time.Duration
+		want   time.Duration
+	}{
+		{"host delay", "User-agent: *\nAllow: /\n", 50 * time.Millisecond, 50 * time.Millisecond},
+		{"robots crawl-delay", "User-agent: *\nCrawl-delay: 0.1\n", 10 * time.Millisecond, 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newLinkServer(t, tt.robots, nil)
+			urls := []string{server.URL + "/a", server.URL + "/b", server.URL + "/c"}
+
+			scraper := newRecordingScraper(0)
+			scrapeConcurrently(context.Background(), scraper, urls, ScrapeOptions{MaxConcurrency: 3, MaxPerHost: 3, HostDelay: tt.delay})
+
+			u, _ := url.Parse(server.URL)
+			// Timers may fire a hair early relative to the recorded start.
+			if gap := scraper.minGap(u.Host); gap < tt.want-5*time.Millisecond {
+				t.Errorf("Requests to one host were %v apart, want at least %v", gap, tt.want)
+			}
+		})
+	}
+}
+
+// slowScraper answers every page right away except those ending in /slow,
+// which wait for ctx, and those ending in /stuck, which ignore ctx and never
+// answer.
+type slowScraper struct{}
+
+func (slowScraper) Scrape(ctx context.Context, urls []string) ([]ScrapeResult, error) {
+	var results []ScrapeResult
+	for _, pageURL := range urls {
+		switch {
+		case strings.HasSuffix(pageURL, "/slow"):
+			<-ctx.Done()
+			results = append(results, failedScrape(pageURL, ctx.Err()))
+		case strings.HasSuffix(pageURL, "/stuck"):
+			select {}
+		default:
+			results = append(results, ScrapeResult{SchemaVersion: ScrapeSchemaVersion, Url: pageURL, Title: "done"})
+		}
+	}
+	return results, nil
+}
+
+func TestScrapeSitesTimesOutPerURL(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	urls := []string{server.URL + "/a", server.URL + "/slow", server.URL + "/b"}
+
+	opts := fastScrapeOptions
+	opts.URLTimeout = 50 * time.Millisecond
+	results, err := ScrapeSitesWith(context.Background(), slowScraper{}, urls, opts)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	if results[0].Title != "done" || results[2].Title != "done" {
+		t.Errorf("Fast pages should finish, got %+v and %+v", results[0], results[2])
+	}
+	if results[1].Status != StatusTimeout || results[1].Error == "" {
+		t.Errorf("Slow page should time out, got %+v", results[1])
+	}
+}
+
+func TestScrapeSitesReturnsPartialResultsAtDeadline(t *testing.T) {
+	stuck := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	polite := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	// One of the polite host's pages is still waiting out the host delay when
+	// the batch deadline passes, the other has long finished.
+	urls := []string{stuck.URL + "/stuck", polite.URL + "/a", polite.URL + "/b"}
+
+	opts := ScrapeOptions{MaxConcurrency: 4, MaxPerHost: 1, HostDelay: time.Minute, RequestTimeout: 200 * time.Millisecond}
+	start := time.Now()
+	results, err := ScrapeSitesWith(context.Background(), slowScraper{}, urls, opts)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Batch should end at its deadline, took %v", elapsed)
+	}
+	if results[0].Status != StatusTimeout {
+		t.Errorf("Stuck page should time out, got %+v", results[0])
+	}
+	done, timedOut := 0, 0
+	for i, result := range results[1:] {
+		if result.Url != urls[i+1] {
+			t.Fatalf("Result %d is for %s, want %s", i+1, result.Url, urls[i+1])
+		}
+		switch {
+		case result.Title == "done":
+			done++
+		case result.Status == StatusTimeout:
+			timedOut++
+		}
+	}
+	if done != 1 || timedOut != 1 {
+		t.Errorf("Expected one finished and one timed out page on the polite host, got %+v", results[1:])
+	}
+}
+
+func TestScrapeSitesBoundsRobotsFetches(t *testing.T) {
+	hung := func() *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	first, second := hung(), hung()
+	healthy := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	urls := []string{first.URL + "/a", second.URL + "/b", healthy.URL + "/c"}
+
+	opts := fastScrapeOptions
+	opts.RequestTimeout = 200 * time.Millisecond
+	start := time.Now()
+	results, err := ScrapeSitesWith(context.Background(), slowScraper{}, urls, opts)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Hung robots.txt fetches should end at the deadline, took %v", elapsed)
+	}
+	for i, result := range results[:2] {
+		if result.Status != StatusTimeout {
+			t.Errorf("Page %d behind a hung robots.txt should time out, got %+v", i, result)
+		}
+	}
+	if results[2].Title != "done" {
+		t.Errorf("A healthy host should not wait for hung ones, got %+v", results[2])
+	}
+}
+
+func TestScrapeSitesStopsWhenCanceled(t *testing.T) {
+	server := newLinkServer(t, "User-agent: *\nAllow: /\n", nil)
+	urls := []string{server.URL + "/slow", server.URL + "/stuck"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	results, err := ScrapeSitesWith(ctx, slowScraper{}, urls, fastScrapeOptions)
+	if err != nil {
+		t.Fatalf("ScrapeSitesWith failed: %v", err)
+	}
+
+	for i, result := range results {
+		if result.Error == "" || result.Status == StatusTimeout {
+			t.Errorf("Canceled page %d should fail without a timeout status, got %+v", i, result)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+const (
+	ScraperPython = "python"
+	ScraperNative = "native"
+	ScraperAuto   = "auto"
+
+	defaultPythonPath = "./venv/bin/python3"
+)
+
+// ScraperBackend picks the scraper used when a request does not name one. The
+// default, auto, uses the Python scraper when its venv is installed and the
+// native one otherwise.
+var ScraperBackend = getEnv("SCRAPER_BACKEND", ScraperAuto)
+
+// Scraper fetches pages and extracts their title, description, keywords, links,
+// images and main content. Results come back in the order of urls, a page that
+// fails gets an entry with an error rather than failing the whole batch. Once
+// ctx ends, pages still in progress are abandoned and fail with ctx's error.
+type Scraper interface {
+	Scrape(ctx context.Context, urls []string) ([]ScrapeResult, error)
+}
+
+// NewScraper returns the scraper for backend, one of python, native or auto.
+// An empty backend means ScraperBackend.
+func NewScraper(backend string) (Scraper, error) {
+	if backend == "" {
+		backend = ScraperBackend
+	}
+
+	switch backend {
+	case ScraperPython:
+		return sharedPythonPool(), nil
+	case ScraperNative:
+		return NewNativeScraper(), nil
+	case ScraperAuto:
+		if _, err := os.Stat(defaultPythonPath); err == nil {
+			return sharedPythonPool(), nil
+		}
+		return NewNativeScraper(), nil
+	default:
+		return nil, fmt.Errorf("unknown scraper backend %q, expected python, native or auto", backend)
+	}
+}
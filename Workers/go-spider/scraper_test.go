@@ -1,19 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"testing"
 )
 
 // MockScrapeSites is a test version that doesn't call Python
-func MockScrapeSites(urls []string) ([]map[string]interface{}, error) {
+func MockScrapeSites(urls []string) ([]ScrapeResult, error) {
 	// For testing, return mock data instead of calling Python
-	return []map[string]interface{}{
+	return []ScrapeResult{
 		{
-			"url":     urls[0],
-			"title":   "Test Page",
-			"content": "Test content",
+			SchemaVersion: ScrapeSchemaVersion,
+			Url:           urls[0],
+			Title:         "Test Page",
+			Content:       "Test content",
 		},
 	}, nil
 }
@@ -22,7 +24,7 @@ func TestScrapeSitesWithValidURLs(t *testing.T) {
 	urls := []string{"https://web-scraping.dev/testimonials"}
 
 	// Use mock instead of actual scrape
-	results, err := ScrapeSites(urls)
+	results, err := ScrapeSites(context.Background(), urls)
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
@@ -32,15 +34,15 @@ func TestScrapeSitesWithValidURLs(t *testing.T) {
 		t.Fatalf("Expected results, got empty slice")
 	}
 
-	if results[0]["url"] != urls[0] {
-		t.Errorf("URL mismatch: got %v, want %s", results[0]["url"], urls[0])
+	if results[0].Url != urls[0] {
+		t.Errorf("URL mismatch: got %v, want %s", results[0].Url, urls[0])
 	}
 }
 
 func TestScrapeSitesReturnsMap(t *testing.T) {
 	urls := []string{"https://example.com", "https://example2.com"}
 
-	results, err := ScrapeSites(urls)
+	results, err := ScrapeSites(context.Background(), urls)
 
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
@@ -50,9 +52,9 @@ func TestScrapeSitesReturnsMap(t *testing.T) {
 		t.Fatal("Expected at least one result")
 	}
 
-	// Check that result is a map
+	// Check that result has its url
 	result := results[0]
-	if _, ok := result["url"]; !ok {
+	if result.Url == "" {
 		t.Error("Result missing 'url' field")
 	}
 }
@@ -64,7 +66,7 @@ func TestScrapeSitesIntegration(t *testing.T) {
 	}
 
 	urls := []string{"https://example.com"}
-	results, err := ScrapeSites(urls)
+	results, err := ScrapeSites(context.Background(), urls)
 
 	if err != nil {
 		t.Fatalf("ScrapeSites failed: %v", err)
@@ -101,7 +103,7 @@ func TestScrapeSitesJSONMarshal(t *testing.T) {
 func TestScrapeSitesEmptyInput(t *testing.T) {
 	urls := []string{}
 
-	results, err := ScrapeSites(urls)
+	results, err := ScrapeSites(context.Background(), urls)
 
 	// Should handle empty input gracefully
 	if err != nil {
@@ -118,35 +120,37 @@ func TestScrapeSitesOutputFormat(t *testing.T) {
 	// Simulate what Python script returns (from stealth_scrape.py)
 	mockOutput := []map[string]interface{}{
 		{
-			"url":         "https://example.com",
-			"links":       []string{"https://example.com/page1", "https://example.com/page2"},
-			"title":       "Example Website",
-			"description": "An example website",
-			"content":     "Main page content here",
-			"images":      []string{"https://example.com/img1.jpg"},
-			"keywords":    "example, website, test",
+			"schemaVersion": ScrapeSchemaVersion,
+			"url":           "https://example.com",
+			"links":         []string{"https://example.com/page1", "https://example.com/page2"},
+			"title":         "Example Website",
+			"description":   "An example website",
+			"content":       "Main page content here",
+			"images":        []string{"https://example.com/img1.jpg"},
+			"keywords":      "example, website, test",
 		},
 	}
 
 	jsonBytes, _ := json.Marshal(mockOutput)
 
-	var results []map[string]interface{}
-	err := json.Unmarshal(jsonBytes, &results)
-
+	var results []ScrapeResult
+	err := decodeStrict(jsonBytes, &results)
 	if err != nil {
-		t.Fatalf("Failed to unmarshal expected format: %v", err)
+		t.Fatalf("Failed to decode expected format: %v", err)
 	}
 
 	if len(results) != 1 {
-		t.Errorf("Expected 1 result, got %d", len(results))
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+	if err := results[0].Validate(); err != nil {
+		t.Errorf("Expected a valid result, got %v", err)
 	}
 
-	// Check expected fields exist
-	expectedFields := []string{"url", "links", "title", "description", "content", "images", "keywords"}
-	for _, field := range expectedFields {
-		if _, ok := results[0][field]; !ok {
-			t.Errorf("Missing expected field: %s", field)
-		}
+	// Check expected fields survive decoding
+	result := results[0]
+	if result.Url == "" || len(result.Links) != 2 || result.Title == "" || result.Description == "" ||
+		result.Content == "" || len(result.Images) != 1 || result.Keywords == "" {
+		t.Errorf("Missing expected fields: %+v", result)
 	}
 }
 
@@ -155,27 +159,26 @@ func TestScrapeSitesHandlesError(t *testing.T) {
 	// Simulate Python script returning error for one URL
 	mockOutput := []map[string]interface{}{
 		{
-			"url":   "https://example.com",
-			"error": "Connection timeout",
+			"schemaVersion": ScrapeSchemaVersion,
+			"url":           "https://example.com",
+			"error":         "Connection timeout",
 		},
 	}
 
 	jsonBytes, _ := json.Marshal(mockOutput)
 
-	var results []map[string]interface{}
-	err := json.Unmarshal(jsonBytes, &results)
-
+	var results []ScrapeResult
+	err := decodeStrict(jsonBytes, &results)
 	if err != nil {
-		t.Fatalf("Failed to unmarshal error response: %v", err)
+		t.Fatalf("Failed to decode error response: %v", err)
 	}
 
 	// Check that error field exists when scrape fails
-	if errorMsg, ok := results[0]["error"]; ok {
-		if errorMsg != "Connection timeout" {
-			t.Errorf("Error message mismatch: got %v", errorMsg)
-		}
-	} else {
-		t.Error("Expected error field in response")
+	if results[0].Error != "Connection timeout" {
+		t.Errorf("Error message mismatch: got %q", results[0].Error)
+	}
+	if err := results[0].Validate(); err != nil {
+		t.Errorf("Error results should be valid, got %v", err)
 	}
 }
 
@@ -183,42 +186,48 @@ func TestScrapeSitesHandlesError(t *testing.T) {
 func TestScrapeSitesMultipleURLs(t *testing.T) {
 	mockOutput := []map[string]interface{}{
 		{
-			"url":     "https://example.com",
-			"title":   "Example 1",
-			"content": "Content 1",
+			"schemaVersion": ScrapeSchemaVersion,
+			"url":           "https://example.com",
+			"title":         "Example 1",
+			"content":       "Content 1",
 		},
 		{
-			"url":   "https://example2.com",
-			"error": "Timeout",
+			"schemaVersion": ScrapeSchemaVersion,
+			"url":           "https://example2.com",
+			"error":         "Timeout",
 		},
 		{
-			"url":     "https://example3.com",
-			"title":   "Example 3",
-			"content": "Content 3",
+			"schemaVersion": ScrapeSchemaVersion,
+			"url":           "https://example3.com",
+			"title":         "Example 3",
+			"content":       "Content 3",
 		},
 	}
 
 	jsonBytes, _ := json.Marshal(mockOutput)
 
-	var results []map[string]interface{}
-	json.Unmarshal(jsonBytes, &results)
+	var results []ScrapeResult
+	err := decodeStrict(jsonBytes, &results)
+	if err != nil {
+		t.Fatalf("Failed to decode results: %v", err)
+	}
 
 	if len(results) != 3 {
-		t.Errorf("Expected 3 results, got %d", len(results))
+		t.Fatalf("Expected 3 results, got %d", len(results))
 	}
 
 	// First should succeed
-	if _, ok := results[0]["title"]; !ok {
+	if results[0].Title == "" {
 		t.Error("First result should have title")
 	}
 
 	// Second should have error
-	if _, ok := results[1]["error"]; !ok {
+	if results[1].Error == "" {
 		t.Error("Second result should have error field")
 	}
 
 	// Third should succeed
-	if _, ok := results[2]["content"]; !ok {
+	if results[2].Content == "" {
 		t.Error("Third result should have content")
 	}
 }
@@ -229,7 +238,7 @@ func BenchmarkScrapeSites(b *testing.B) {
 		"https://words.filippo.io/claude-debugging/", "https://www.temu.com", "https://zacharymunshaw.dev/"}
 
 	for i := 0; i < b.N; i++ {
-		_, _ = ScrapeSites(urls)
+		_, _ = ScrapeSites(context.Background(), urls)
 	}
 }
 
@@ -237,6 +246,27 @@ func BenchmarkScrapeSingleSite(b *testing.B) {
 	urls := []string{"https://web-scraping.dev/products"}
 
 	for i := 0; i < b.N; i++ {
-		_, _ = ScrapeSites(urls)
+		_, _ = ScrapeSites(context.Background(), urls)
+	}
+}
+
+func TestNewScraperSelectsBackend(t *testing.T) {
+	if _, ok := mustScraper(t, ScraperNative).(*NativeScraper); !ok {
+		t.Error("native should select the NativeScraper")
+	}
+	if _, ok := mustScraper(t, ScraperPython).(*PythonPool); !ok {
+		t.Error("python should select the PythonPool")
+	}
+	if _, err := NewScraper("chrome"); err == nil {
+		t.Error("Expected an error for an unknown backend")
+	}
+}
+
+func mustScraper(t *testing.T, backend string) Scraper {
+	t.Helper()
+	scraper, err := NewScraper(backend)
+	if err != nil {
+		t.Fatalf("NewScraper(%q) failed: %v", backend, err)
 	}
+	return scraper
 }
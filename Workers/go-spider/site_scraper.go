@@ -1,37 +1,111 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"os/exec"
+	"strings"
 )
 
-func ScrapeSites(urls []string) ([]map[string]interface{}, error) {
-	jsonBytes, err := json.Marshal(urls)
+// ScrapeSites scrapes urls with the configured ScraperBackend and
+// DefaultScrapeOptions.
+func ScrapeSites(ctx context.Context, urls []string) ([]ScrapeResult, error) {
+	scraper, err := NewScraper("")
 	if err != nil {
 		return nil, err
 	}
+	return ScrapeSitesWith(ctx, scraper, urls, DefaultScrapeOptions())
+}
 
-	venvPath := "./venv/bin/python3"
-	cmd := exec.Command(venvPath, "python/stealth_scrape.py", string(jsonBytes))
+// ScrapeSitesWith scrapes the urls robots.txt allows with scraper, concurrently
+// within opts, and reports the rest as disallowed, keeping the input order.
+// URLs are canonicalized before scraping, one that cannot be is not scraped and
+// fails with the reason. Results echo the URL as requested
+// in Url and the scraped one in CanonicalUrl, and links are canonicalized
+// whichever scraper found them. Links, images and canonical
+// URLs that are not absolute http(s) URLs are dropped, results that still fail
+// validation are replaced with an error result for their URL, the others are
+// fingerprinted, flagged when they nearly duplicate a recent page, and have
+// their content chunked within opts.ChunkTokens.
+// Pages that do not finish within opts.RequestTimeout, or before ctx ends, are
+// reported as timed out while the rest of the batch is returned as usual.
+func ScrapeSitesWith(ctx context.Context, scraper Scraper, urls []string, opts ScrapeOptions) ([]ScrapeResult, error) {
+	if opts.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.RequestTimeout)
+		defer cancel()
+	}
 
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
+	requested := urls
+	urls = make([]string, len(requested))
+	invalid := make([]error, len(requested))
+	var scrapable []string
+	for i, url := range requested {
+		if urls[i], invalid[i] = urlCanonicalizer.Canonicalize(nil, url); invalid[i] != nil {
+			urls[i] = strings.TrimSpace(url)
+			continue
+		}
+		scrapable = append(scrapable, urls[i])
+	}
 
-	err = cmd.Run()
-	if err != nil {
-		fmt.Printf("Python error: %s CMD Error: %s\n", out.String(), err.Error())
-		return nil, err
+	// robots.txt is checked per URL inside the deadline, so a host that never
+	// answers for its robots.txt only holds up its own pages.
+	scraped := scrapeConcurrently(ctx, scraper, scrapable, opts)
+
+	results := make([]ScrapeResult, len(urls))
+	for i := range results {
+		var result ScrapeResult
+		if invalid[i] != nil {
+			result = failedScrape(urls[i], fmt.Errorf("invalid url: %w", invalid[i]))
+		} else {
+			result, scraped = scraped[0], scraped[1:]
+			result = checkScrapeResult(result, urls[i])
+		}
+		canonicalizeLinks(&result)
+		fingerprintResult(fingerprints, &result)
+		result.Chunks = nil
+		if result.Error == "" {
+			result.Chunks = ChunkContent(result.Content, result.Headings, opts.ChunkTokens, opts.ChunkOverlap)
+		}
+		result.Url, result.CanonicalUrl = requested[i], ""
+		if isAbsoluteHTTPURL(urls[i]) {
+			result.CanonicalUrl = urls[i]
+		}
+		results[i] = result
 	}
 
-	var results []map[string]interface{}
-	err = json.Unmarshal(out.Bytes(), &results)
+	return results, nil
+}
+
+// checkScrapeResult drops the unusable URLs of a result for pageURL and
+// replaces it with an error result when it still fails validation.
+func checkScrapeResult(result ScrapeResult, pageURL string) ScrapeResult {
+	if dropped := result.dropInvalidUrls(); dropped > 0 {
+		fmt.Printf("Dropped %d unusable urls from the scrape of %s\n", dropped, pageURL)
+	}
+	err := result.Validate()
+	if err == nil && result.Url != pageURL {
+		err = fmt.Errorf("result for %q returned in place of %q", result.Url, pageURL)
+	}
 	if err != nil {
-		fmt.Printf("JSON parse error: %s\n", out.String())
-		return nil, err
+		fmt.Printf("Rejected scrape result for %s: %v\n", pageURL, err)
+		return failedScrape(pageURL, fmt.Errorf("invalid scrape result: %w", err))
 	}
+	return result
+}
 
-	return results, nil
+// canonicalizeLinks canonicalizes the links and canonical URL of a validated
+// result, dropping links that become duplicates.
+func canonicalizeLinks(result *ScrapeResult) {
+	if result.Canonical != "" {
+		result.Canonical = CanonicalURL(result.Canonical)
+	}
+	if len(result.Links) == 0 {
+		return
+	}
+	links := make([]string, 0, len(result.Links))
+	seen := make(map[string]bool)
+	for _, link := range result.Links {
+		appendUnique(&links, seen, CanonicalURL(link))
+	}
+	result.Links = links
 }
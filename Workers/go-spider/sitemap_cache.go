@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SitemapCacheTTL is how long a cached sitemap may go without being
+	// revalidated before it is dropped.
+	SitemapCacheTTL = 24 * time.Hour
+
+	maxSitemapCacheEntries = 256
+	// maxSitemapCacheUrls bounds the entries of all cached documents together,
+	// a single document may hold up to MaxSitemapUrls.
+	maxSitemapCacheUrls = 200000
+)
+
+// sitemapCache remembers the validators and parse of every sitemap that sent
+// an ETag or Last-Modified, so repeated /map calls only download what changed.
+var sitemapCache = NewSitemapCache(maxSitemapCacheEntries, maxSitemapCacheUrls, SitemapCacheTTL)
+
+type SitemapCache struct {
+	maxEntries int
+	maxUrls    int
+	ttl        time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*sitemapCacheEntry
+	urls    int // the entries of every cached document
+}
+
+type sitemapCacheEntry struct {
+	ETag         string
+	LastModified string
+	Sitemap      Sitemap
+	stored       time.Time
+}
+
+func NewSitemapCache(maxEntries, maxUrls int, ttl time.Duration) *SitemapCache {
+	return &SitemapCache{
+		maxEntries: maxEntries,
+		maxUrls:    maxUrls,
+		ttl:        ttl,
+		entries:    make(map[string]*sitemapCacheEntry),
+	}
+}
+
+// Get returns the cached entry for sitemapURL, unless it has expired.
+func (c *SitemapCache) Get(sitemapURL string) (*sitemapCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[sitemapURL]
+	if ok && time.Since(entry.stored) > c.ttl {
+		c.remove(sitemapURL)
+		return nil, false
+	}
+	return entry, ok
+}
+
+// Put stores entry for sitemapURL, evicting the oldest entries until both the
+// entry and URL limits hold. A document too large to ever fit is not stored.
+func (c *SitemapCache) Put(sitemapURL string, entry *sitemapCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(sitemapURL)
+	size := entry.size()
+	if size > c.maxUrls {
+		return
+	}
+	for len(c.entries) > 0 && (len(c.entries) >= c.maxEntries || c.urls+size > c.maxUrls) {
+		var oldest string
+		for location, cached := range c.entries {
+			if oldest == "" || cached.stored.Before(c.entries[oldest].stored) {
+				oldest = location
+			}
+		}
+		c.remove(oldest)
+	}
+	entry.stored = time.Now()
+	c.entries[sitemapURL] = entry
+	c.urls += size
+}
+
+// remove drops the entry for sitemapURL, callers must hold c.mu.
+func (c *SitemapCache) remove(sitemapURL string) {
+	if entry, ok := c.entries[sitemapURL]; ok {
+		c.urls -= entry.size()
+		delete(c.entries, sitemapURL)
+	}
+}
+
+func (e *sitemapCacheEntry) size() int {
+	return len(e.Sitemap.UrlSet.URL) + len(e.Sitemap.SiteIndex.Sitemap)
+}
+
+// LoadSitemap fetches and parses a sitemap, revalidating a cached copy with
+// If-None-Match and If-Modified-Since when there is one. The status says whether
+// the result was downloaded (StatusFresh) or reused after a 304 (StatusCached).
+func LoadSitemap(ctx context.Context, sitemapURL string) (Sitemap, FetchStatus, error) {
+	cached, _ := sitemapCache.Get(sitemapURL)
+
+	resp, err := fetchSitemapIfModified(ctx, sitemapURL, cached)
+	if err != nil {
+		return Sitemap{}, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		fmt.Printf("Sitemap not modified, using cached copy of %s\n", sitemapURL)
+		sitemapCache.Put(sitemapURL, &sitemapCacheEntry{
+			ETag:         firstNonEmpty(resp.Header.Get("ETag"), cached.ETag),
+			LastModified: firstNonEmpty(resp.Header.Get("Last-Modified"), cached.LastModified),
+			Sitemap:      cached.Sitemap,
+		})
+		return cached.Sitemap, StatusCached, nil
+	}
+
+	data, err := readSitemapBody(sitemapURL, resp)
+	if err != nil {
+		return Sitemap{}, "", err
+	}
+
+	sitemap, err := ParseSitemap(sitemapURL, data)
+	if err != nil {
+		return Sitemap{}, "", err
+	}
+
+	etag := strings.TrimSpace(resp.Header.Get("ETag"))
+	lastModified := strings.TrimSpace(resp.Header.Get("Last-Modified"))
+	if etag != "" || lastModified != "" {
+		sitemapCache.Put(sitemapURL, &sitemapCacheEntry{
+			ETag:         etag,
+			LastModified: lastModified,
+			Sitemap:      sitemap,
+		})
+	}
+
+	return sitemap, StatusFresh, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
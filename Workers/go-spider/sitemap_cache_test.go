@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMapSiteRevalidatesCachedSitemaps(t *testing.T) {
+	const lastModified = "Tue, 10 Jun 2025 04:00:00 GMT"
+	var downloads atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "Sitemap: %s/sitemap_index.xml\n", server.URL)
+		case "/sitemap_index.xml":
+			fmt.Fprint(w, strings.ReplaceAll(sitemapIndexDoc("/etag.xml", "/dated.xml", "/plain.xml"), "{{host}}", server.URL))
+		case "/etag.xml":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads.Add(1)
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, strings.ReplaceAll(urlSetDoc("/a", "/b"), "{{host}}", server.URL))
+		case "/dated.xml":
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads.Add(1)
+			w.Header().Set("Last-Modified", lastModified)
+			fmt.Fprint(w, strings.ReplaceAll(urlSetDoc("/c"), "{{host}}", server.URL))
+		case "/plain.xml":
+			fmt.Fprint(w, strings.ReplaceAll(urlSetDoc("/d"), "{{host}}", server.URL))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	first, err := MapSite(context.Background(), server.URL, DefaultSitemapDepth)
+	if err != nil {
+		t.Fatalf("MapSite failed: %v", err)
+	}
+	second, err := MapSite(context.Background(), server.URL, DefaultSitemapDepth)
+	if err != nil {
+		t.Fatalf("MapSite failed: %v", err)
+	}
+
+	if downloads.Load() != 2 {
+		t.Errorf("Expected the validated sitemaps to be downloaded once each, got %d downloads", downloads.Load())
+	}
+
+	children := func(site BackendSitemap) []BackendSitemap { return site.SitemapIndex[0].SitemapIndex }
+	for i, want := range []FetchStatus{StatusFresh, StatusFresh, StatusFresh} {
+		if got := children(first)[i].Status; got != want {
+			t.Errorf("First run child %d: status %q, want %q", i, got, want)
+		}
+	}
+	for i, want := range []FetchStatus{StatusCached, StatusCached, StatusFresh} {
+		if got := children(second)[i].Status; got != want {
+			t.Errorf("Second run child %d: status %q, want %q", i, got, want)
+		}
+	}
+	if cached := children(second)[0]; !cached.IsMapped || len(cached.UrlSet) != 2 {
+		t.Errorf("Cached sitemap should carry its urls: mapped=%v urls=%d", cached.IsMapped, len(cached.UrlSet))
+	}
+}
+
+func TestSitemapCacheEvictsOldest(t *testing.T) {
+	cache := NewSitemapCache(2, 100, time.Hour)
+	cache.Put("https://example.com/a.xml", &sitemapCacheEntry{ETag: "a"})
+	cache.Put("https://example.com/b.xml", &sitemapCacheEntry{ETag: "b"})
+	cache.Put("https://example.com/c.xml", &sitemapCacheEntry{ETag: "c"})
+
+	if _, ok := cache.Get("https://example.com/a.xml"); ok {
+		t.Error("Oldest entry should have been evicted")
+	}
+	if entry, ok := cache.Get("https://example.com/c.xml"); !ok || entry.ETag != "c" {
+		t.Errorf("Newest entry missing: %+v", entry)
+	}
+}
+
+func TestSitemapCacheBoundsUrlsAndAge(t *testing.T) {
+	withUrls := func(n int) *sitemapCacheEntry {
+		entry := &sitemapCacheEntry{ETag: fmt.Sprint(n)}
+		entry.Sitemap.UrlSet.URL = make([]SitemapUrl, n)
+		return entry
+	}
+
+	cache := NewSitemapCache(10, 100, time.Hour)
+	cache.Put("https://example.com/a.xml", withUrls(60))
+	cache.Put("https://example.com/b.xml", withUrls(30))
+	cache.Put("https://example.com/c.xml", withUrls(30))
+	if _, ok := cache.Get("https://example.com/a.xml"); ok {
+		t.Error("Oldest entry should make room for the url limit")
+	}
+	if cache.urls != 60 {
+		t.Errorf("Expected 60 cached urls, got %d", cache.urls)
+	}
+	cache.Put("https://example.com/huge.xml", withUrls(101))
+	if _, ok := cache.Get("https://example.com/huge.xml"); ok || cache.urls != 60 {
+		t.Errorf("A document over the url limit should not be cached, %d urls cached", cache.urls)
+	}
+
+	cache = NewSitemapCache(10, 100, time.Millisecond)
+	cache.Put("https://example.com/a.xml", withUrls(1))
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := cache.Get("https://example.com/a.xml"); ok || cache.urls != 0 {
+		t.Error("Expired entry should be dropped")
+	}
+}
+
+func TestMapSiteReportsDiscoveredSitemapAsFresh(t *testing.T) {
+	var requests atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sitemap.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, strings.ReplaceAll(urlSetDoc("/a"), "{{host}}", server.URL))
+	}))
+	defer server.Close()
+
+	for i, want := range []FetchStatus{StatusFresh, StatusCached} {
+		site, err := MapSite(context.Background(), server.URL, DefaultSitemapDepth)
+		if err != nil {
+			t.Fatalf("MapSite failed: %v", err)
+		}
+		if child := site.SitemapIndex[0]; child.Status != want || !child.IsMapped || len(child.UrlSet) != 1 {
+			t.Errorf("Run %d: expected a mapped %q sitemap, got status %q with %d urls", i, want, child.Status, len(child.UrlSet))
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected one sitemap request per run, got %d", n)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// SitemapHandler receives entries from StreamSitemap as soon as each one has
+// been decoded. Either callback may be nil, returning an error stops the stream.
+type SitemapHandler struct {
+	OnUrl     func(SitemapUrl) error
+	OnSitemap func(SitemapIndexEntry) error
+}
+
+// StreamSitemap decodes a sitemap token by token and hands every <url> and
+// <sitemap> entry to handler as it is read, so memory stays bounded by the size
+// of a single entry however large the document is. Plain-text sitemaps are read
+// line by line; RSS and Atom feeds are small by nature and decoded whole. Broken
+// documents fail with the same SitemapParseError as ParseSitemap.
+func StreamSitemap(r io.Reader, handler SitemapHandler) error {
+	reader := bufio.NewReader(r)
+	if first, err := peekSignificantByte(reader); err != nil || first != '<' {
+		return streamTextSitemap(reader, handler)
+	}
+
+	decoder := newSitemapStreamDecoder(reader)
+	root, rootErr := sitemapRoot(decoder)
+	if rootErr != nil {
+		return rootErr
+	}
+	if root.Name.Local != "urlset" && root.Name.Local != "sitemapindex" {
+		return streamFeed(decoder, root, handler)
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return malformedXML("", decoder, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "url":
+			var entry SitemapUrl
+			if err := decoder.DecodeElement(&entry, &start); err != nil {
+				return malformedXML("", decoder, err)
+			}
+			if err := emit(handler.OnUrl, entry); err != nil {
+				return err
+			}
+		case "sitemap":
+			var entry SitemapIndexEntry
+			if err := decoder.DecodeElement(&entry, &start); err != nil {
+				return malformedXML("", decoder, err)
+			}
+			if err := emit(handler.OnSitemap, entry); err != nil {
+				return err
+			}
+		default:
+			if err := decoder.Skip(); err != nil {
+				return malformedXML("", decoder, err)
+			}
+		}
+	}
+}
+
+// peekSignificantByte drops a leading BOM and whitespace and returns the next
+// byte without consuming it. Unlike peeking a fixed window it never waits for
+// more input than the first byte of content.
+func peekSignificantByte(reader *bufio.Reader) (byte, error) {
+	if bom, err := reader.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		reader.Discard(3)
+	}
+	for {
+		next, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch next[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.Discard(1)
+		default:
+			return next[0], nil
+		}
+	}
+}
+
+func streamTextSitemap(r io.Reader, handler SitemapHandler) error {
+	scanner := bufio.NewScanner(r)
+	for count := 0; scanner.Scan() && count < MaxSitemapUrls; {
+		line := strings.TrimSpace(scanner.Text())
+		if !isAbsoluteHTTPURL(line) {
+			continue
+		}
+		count++
+		if err := emit(handler.OnUrl, SitemapUrl{Loc: line}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func streamFeed(decoder *xml.Decoder, start xml.StartElement, handler SitemapHandler) error {
+	var feed UrlSet
+	if start.Name.Local == "feed" {
+		var atom AtomFeed
+		if err := decoder.DecodeElement(&atom, &start); err != nil {
+			return malformedXML("", decoder, err)
+		}
+		feed = atom.toUrlSet()
+	} else {
+		var rss RssFeed
+		if err := decoder.DecodeElement(&rss, &start); err != nil {
+			return malformedXML("", decoder, err)
+		}
+		feed = rss.toUrlSet()
+	}
+
+	for _, entry := range feed.URL {
+		if err := emit(handler.OnUrl, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func emit[T any](callback func(T) error, entry T) error {
+	if callback == nil {
+		return nil
+	}
+	return callback(entry)
+}
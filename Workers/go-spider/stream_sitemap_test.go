@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStreamSitemapEmitsBeforeDocumentEnds(t *testing.T) {
+	reader, writer := io.Pipe()
+	received := make(chan string, 10)
+
+	done := make(chan error)
+	go func() {
+		done <- StreamSitemap(reader, SitemapHandler{
+			OnUrl: func(entry SitemapUrl) error {
+				received <- entry.Loc
+				return nil
+			},
+		})
+	}()
+
+	io.WriteString(writer, `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	io.WriteString(writer, `<url><loc>https://example.com/first</loc></url>`)
+
+	select {
+	case loc := <-received:
+		if loc != "https://example.com/first" {
+			t.Errorf("Unexpected first url %s", loc)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("First url was not emitted before the document finished")
+	}
+
+	io.WriteString(writer, `<url><loc>https://example.com/second</loc></url></urlset>`)
+	writer.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("StreamSitemap failed: %v", err)
+	}
+	if loc := <-received; loc != "https://example.com/second" {
+		t.Errorf("Unexpected second url %s", loc)
+	}
+}
+
+func TestStreamSitemapFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		urls     int
+		sitemaps int
+	}{
+		{"urlset", urlSetDoc("/a", "/b", "/c"), 3, 0},
+		{"index", sitemapIndexDoc("/a.xml", "/b.xml"), 0, 2},
+		{"text", "https://example.com/a\nhttps://example.com/b\n", 2, 0},
+		{"rss", `<rss><channel><item><link>https://example.com/a</link></item></channel></rss>`, 1, 0},
+		{"atom", `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link href="https://example.com/a"/></entry></feed>`, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var urls, sitemaps int
+			err := StreamSitemap(strings.NewReader(tt.doc), SitemapHandler{
+				OnUrl:     func(SitemapUrl) error { urls++; return nil },
+				OnSitemap: func(SitemapIndexEntry) error { sitemaps++; return nil },
+			})
+			if err != nil {
+				t.Fatalf("StreamSitemap failed: %v", err)
+			}
+			if urls != tt.urls || sitemaps != tt.sitemaps {
+				t.Errorf("Got %d urls and %d sitemaps, want %d and %d", urls, sitemaps, tt.urls, tt.sitemaps)
+			}
+		})
+	}
+}
+
+func TestMapRequestStreamsNDJSON(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/robots.txt": "Sitemap: {{host}}/index.xml\n",
+		"/index.xml":  sitemapIndexDoc("/pages.xml", "/posts.xml", "/index.xml"),
+		"/pages.xml":  urlSetDoc("/about", "/contact"),
+		"/posts.xml":  urlSetDoc("/post-1"),
+	})
+
+	rec := httptest.NewRecorder()
+	mapRequestHandler(rec, httptest.NewRequest(http.MethodGet, "/map?stream=ndjson&url="+server.URL, nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Unexpected response %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var locs []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var u BackendUrl
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			t.Fatalf("Line is not a BackendUrl: %q", scanner.Text())
+		}
+		locs = append(locs, strings.TrimPrefix(u.Location, server.URL))
+	}
+
+	if strings.Join(locs, ",") != "/about,/contact,/post-1" {
+		t.Errorf("Unexpected streamed urls %v", locs)
+	}
+}
+
+func TestStreamSiteFetchesCommonSitemapOnce(t *testing.T) {
+	var mu sync.Mutex
+	fetches := map[string]int{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			// A soft 404, served at every path but not a sitemap.
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><body>Not found</body></html>")
+		case "/sitemap_index.xml":
+			fmt.Fprint(w, strings.ReplaceAll(sitemapIndexDoc("/pages.xml"), "{{host}}", server.URL))
+		case "/pages.xml":
+			fmt.Fprint(w, strings.ReplaceAll(urlSetDoc("/about"), "{{host}}", server.URL))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var locs []string
+	err := StreamSite(context.Background(), server.URL, DefaultSitemapDepth, func(u BackendUrl) error {
+		locs = append(locs, strings.TrimPrefix(u.Location, server.URL))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamSite failed: %v", err)
+	}
+	if strings.Join(locs, ",") != "/about" {
+		t.Errorf("Unexpected streamed urls %v", locs)
+	}
+	for _, path := range []string{"/sitemap.xml", "/sitemap_index.xml", "/pages.xml"} {
+		if fetches[path] != 1 {
+			t.Errorf("Expected %s to be fetched once, got %d", path, fetches[path])
+		}
+	}
+	if fetches["/sitemap/sitemap.xml"] != 0 {
+		t.Error("Probing should stop at the first common location that yields urls")
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// StructuredData is the machine readable metadata of a page: schema.org
+// JSON-LD and microdata, and the OpenGraph and Twitter card meta tags.
+type StructuredData struct {
+	// JSONLD holds every JSON-LD object, with arrays and @graph containers
+	// flattened into their members.
+	JSONLD    []map[string]interface{} `json:"jsonLd,omitempty"`
+	Microdata []MicrodataItem          `json:"microdata,omitempty"`
+	// OpenGraph is keyed by property without the og: prefix, other OpenGraph
+	// namespaces such as article: keep theirs. Properties may repeat, og:image
+	// for one.
+	OpenGraph map[string][]string `json:"openGraph,omitempty"`
+	// Twitter is keyed by card property without the twitter: prefix.
+	Twitter map[string]string `json:"twitter,omitempty"`
+}
+
+// MicrodataItem is one itemscope. Property values are strings, or nested
+// items for properties that are themselves an itemscope.
+type MicrodataItem struct {
+	Type       []string                 `json:"type,omitempty"`
+	ID         string                   `json:"id,omitempty"`
+	Properties map[string][]interface{} `json:"properties"`
+}
+
+// openGraphNamespaces are the meta property prefixes that belong to OpenGraph.
+var openGraphNamespaces = []string{"og:", "article:", "book:", "profile:", "product:", "music:", "video:"}
+
+func (d *StructuredData) empty() bool {
+	return len(d.JSONLD) == 0 && len(d.Microdata) == 0 && len(d.OpenGraph) == 0 && len(d.Twitter) == 0
+}
+
+// extractStructuredData collects the structured data of doc, resolving
+// microdata URLs against base. It returns nil when the page has none.
+func extractStructuredData(doc *html.Node, base *url.URL) *StructuredData {
+	data := &StructuredData{OpenGraph: map[string][]string{}, Twitter: map[string]string{}}
+
+	walkElements(doc, func(n *html.Node) {
+		switch n.Data {
+		case "script":
+			if strings.EqualFold(strings.TrimSpace(nodeAttr(n, "type")), "application/ld+json") {
+				data.JSONLD = append(data.JSONLD, parseJSONLD(textOf(n))...)
+			}
+		case "meta":
+			addMetaProperty(data, n)
+		}
+		if hasAttr(n, "itemscope") && !hasAttr(n, "itemprop") {
+			data.Microdata = append(data.Microdata, microdataItem(n, base))
+		}
+	})
+
+	if data.empty() {
+		return nil
+	}
+	if len(data.OpenGraph) == 0 {
+		data.OpenGraph = nil
+	}
+	if len(data.Twitter) == 0 {
+		data.Twitter = nil
+	}
+	return data
+}
+
+// parseJSONLD decodes one JSON-LD script into its objects. A top level array
+// and @graph containers are flattened, graph members inherit the container's
+// @context. Scripts that are not valid JSON are skipped.
+func parseJSONLD(script string) []map[string]interface{} {
+	script = strings.TrimSpace(script)
+	// Some sites still wrap scripts in comment or CDATA markers.
+	for _, marker := range [][2]string{{"<!--", "-->"}, {"<![CDATA[", "]]>"}, {"//<![CDATA[", "//]]>"}} {
+		if strings.HasPrefix(script, marker[0]) && strings.HasSuffix(script, marker[1]) {
+			script = strings.TrimSpace(script[len(marker[0]) : len(script)-len(marker[1])])
+		}
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(script), &value); err != nil {
+		return nil
+	}
+	return flattenJSONLD(value, nil)
+}
+
+func flattenJSONLD(value interface{}, context interface{}) []map[string]interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		var objects []map[string]interface{}
+		for _, item := range v {
+			objects = append(objects, flattenJSONLD(item, context)...)
+		}
+		return objects
+	case map[string]interface{}:
+		if ctx, ok := v["@context"]; ok {
+			context = ctx
+		}
+		if graph, ok := v["@graph"]; ok {
+			return flattenJSONLD(graph, context)
+		}
+		if _, ok := v["@context"]; !ok && context != nil {
+			v["@context"] = context
+		}
+		return []map[string]interface{}{v}
+	default:
+		return nil
+	}
+}
+
+func addMetaProperty(data *StructuredData, n *html.Node) {
+	content := strings.TrimSpace(nodeAttr(n, "content"))
+	if content == "" {
+		return
+	}
+	// Both OpenGraph and Twitter tags show up under property and name alike.
+	for _, key := range []string{nodeAttr(n, "property"), nodeAttr(n, "name")} {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if card, ok := strings.CutPrefix(key, "twitter:"); ok && card != "" {
+			if _, seen := data.Twitter[card]; !seen {
+				data.Twitter[card] = content
+			}
+			return
+		}
+		for _, namespace := range openGraphNamespaces {
+			if strings.HasPrefix(key, namespace) && len(key) > len(namespace) {
+				key = strings.TrimPrefix(key, "og:")
+				data.OpenGraph[key] = append(data.OpenGraph[key], content)
+				return
+			}
+		}
+	}
+}
+
+// microdataItem reads the itemscope n and the itemprops under it, stopping at
+// nested itemscopes, which become values of their own itemprop.
+func microdataItem(n *html.Node, base *url.URL) MicrodataItem {
+	item := MicrodataItem{
+		Type:       strings.Fields(nodeAttr(n, "itemtype")),
+		ID:         strings.TrimSpace(nodeAttr(n, "itemid")),
+		Properties: map[string][]interface{}{},
+	}
+
+	var collect func(*html.Node)
+	collect = func(parent *html.Node) {
+		for child := parent.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			names := strings.Fields(nodeAttr(child, "itemprop"))
+			if len(names) > 0 {
+				value := microdataValue(child, base)
+				for _, name := range names {
+					item.Properties[name] = append(item.Properties[name], value)
+				}
+			}
+			if !hasAttr(child, "itemscope") {
+				collect(child)
+			}
+		}
+	}
+	collect(n)
+
+	return item
+}
+
+// microdataValue is the value of an itemprop element as the HTML microdata
+// spec defines it: a nested item, a URL attribute resolved against base, or
+// the element's text.
+func microdataValue(n *html.Node, base *url.URL) interface{} {
+	if hasAttr(n, "itemscope") {
+		return microdataItem(n, base)
+	}
+
+	var urlAttr string
+	switch n.Data {
+	case "meta":
+		return strings.TrimSpace(nodeAttr(n, "content"))
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		urlAttr = "src"
+	case "a", "area", "link":
+		urlAttr = "href"
+	case "object":
+		urlAttr = "data"
+	case "data", "meter":
+		return strings.TrimSpace(nodeAttr(n, "value"))
+	case "time":
+		if datetime := nodeAttr(n, "datetime"); datetime != "" {
+			return strings.TrimSpace(datetime)
+		}
+	}
+	if urlAttr != "" {
+		ref := strings.TrimSpace(nodeAttr(n, urlAttr))
+		if resolved, err := base.Parse(ref); err == nil && ref != "" {
+			return resolved.String()
+		}
+		return ref
+	}
+	return strings.Join(strings.Fields(textOf(n)), " ")
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
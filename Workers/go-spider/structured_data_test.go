@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const structuredPage = `<html><head>
+<meta property="og:title" content="Widget">
+<meta property="og:image" content="https://example.com/a.png">
+<meta property="og:image" content="https://example.com/b.png">
+<meta property="article:author" content="Ann">
+<meta name="twitter:card" content="summary_large_image">
+<meta property="twitter:site" content="@example">
+<meta name="description" content="Not structured">
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [
+  {"@type": "Article", "headline": "Widgets"},
+  {"@type": "BreadcrumbList", "itemListElement": [{"@type": "ListItem", "position": 1, "name": "Home"}]}
+]}
+</script>
+<script type="application/ld+json">[{"@context": "https://schema.org", "@type": "FAQPage"}, {"@type": "Thing"}]</script>
+<script type="application/ld+json">{ not json</script>
+<script type="text/javascript">{"@type": "Ignored"}</script>
+</head><body>
+<div itemscope itemtype="https://schema.org/Product" itemid="urn:widget">
+  <h1 itemprop="name">Widget</h1>
+  <img itemprop="image" src="/widget.png">
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <meta itemprop="priceCurrency" content="EUR">
+    <data itemprop="price" value="9.99">9,99 €</data>
+    <time itemprop="validFrom" datetime="2024-01-01">New year</time>
+  </div>
+  <p><span itemprop="description keywords">Small   and useful</span></p>
+</div>
+<main><p>The widget page body text.</p></main>
+</body></html>`
+
+func TestExtractStructuredData(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/shop/widget")
+	page, err := ExtractPage(pageURL, strings.NewReader(structuredPage))
+	if err != nil {
+		t.Fatalf("ExtractPage failed: %v", err)
+	}
+	data := page.Structured
+	if data == nil {
+		t.Fatal("Expected structured data")
+	}
+
+	var types []interface{}
+	for _, object := range data.JSONLD {
+		types = append(types, object["@type"])
+	}
+	if want := []interface{}{"Article", "BreadcrumbList", "FAQPage", "Thing"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("Expected JSON-LD types %v, got %v", want, types)
+	}
+	if data.JSONLD[1]["@context"] != "https://schema.org" {
+		t.Errorf("Graph members should inherit @context, got %v", data.JSONLD[1])
+	}
+	if _, ok := data.JSONLD[3]["@context"]; ok {
+		t.Errorf("Array members should not share a sibling's @context, got %v", data.JSONLD[3])
+	}
+
+	wantOG := map[string][]string{
+		"title":          {"Widget"},
+		"image":          {"https://example.com/a.png", "https://example.com/b.png"},
+		"article:author": {"Ann"},
+	}
+	if !reflect.DeepEqual(data.OpenGraph, wantOG) {
+		t.Errorf("Expected OpenGraph %v, got %v", wantOG, data.OpenGraph)
+	}
+	if want := map[string]string{"card": "summary_large_image", "site": "@example"}; !reflect.DeepEqual(data.Twitter, want) {
+		t.Errorf("Expected Twitter %v, got %v", want, data.Twitter)
+	}
+
+	if len(data.Microdata) != 1 {
+		t.Fatalf("Expected one top level microdata item, got %d", len(data.Microdata))
+	}
+	product := data.Microdata[0]
+	if !reflect.DeepEqual(product.Type, []string{"https://schema.org/Product"}) || product.ID != "urn:widget" {
+		t.Errorf("Unexpected item %+v", product)
+	}
+	wantProps := map[string][]interface{}{
+		"name":        {"Widget"},
+		"image":       {"https://example.com/widget.png"},
+		"description": {"Small and useful"},
+		"keywords":    {"Small and useful"},
+		"offers": {MicrodataItem{
+			Type: []string{"https://schema.org/Offer"},
+			Properties: map[string][]interface{}{
+				"priceCurrency": {"EUR"},
+				"price":         {"9.99"},
+				"validFrom":     {"2024-01-01"},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(product.Properties, wantProps) {
+		t.Errorf("Unexpected properties %+v", product.Properties)
+	}
+
+	if page.Content != "The widget page body text." {
+		t.Errorf("Main content should be unaffected, got %q", page.Content)
+	}
+}
+
+func TestExtractStructuredDataAbsent(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/")
+	page, _ := ExtractPage(pageURL, strings.NewReader(`<html><head><title>Plain</title></head><body>Text</body></html>`))
+	if page.Structured != nil {
+		t.Errorf("Expected no structured data, got %+v", page.Structured)
+	}
+
+	encoded, _ := json.Marshal(ScrapeResult{SchemaVersion: ScrapeSchemaVersion, Url: "https://example.com/"})
+	if strings.Contains(string(encoded), "structured") {
+		t.Errorf("Empty structured data should be omitted, got %s", encoded)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultSitemapDepth is how many levels of nested sitemap indexes are followed
+// when the caller does not ask for a specific depth.
+const DefaultSitemapDepth = 3
+
+// MapSite discovers every sitemap declared for baseURL and maps each of them as
+// a child of a single site node. The site node itself is synthetic, so it only
+// counts as mapped when at least one declared sitemap could be fetched. Once ctx
+// ends the remaining sitemaps fail, what was mapped by then is kept.
+func MapSite(ctx context.Context, baseURL string, maxDepth int) (BackendSitemap, error) {
+	locations, probed, err := findSitemaps(ctx, baseURL)
+	if err != nil {
+		return BackendSitemap{}, err
+	}
+
+	site := BackendSitemap{
+		Location:     baseURL,
+		LastModified: time.Now(),
+	}
+	for _, location := range locations {
+		site.SitemapIndex = append(site.SitemapIndex, BackendSitemap{Location: location})
+	}
+
+	var loadErr error
+	if probed != nil {
+		// The only child was loaded by discovery, carry on from its children.
+		child := &site.SitemapIndex[0]
+		fillSitemapNode(child, probed.sitemap, probed.status)
+		loadErr = expandSitemapIndex(ctx, child, 1, maxDepth, map[string]bool{sitemapKey(probed.location): true})
+	} else {
+		loadErr = expandSitemapIndex(ctx, &site, 0, maxDepth, map[string]bool{})
+	}
+
+	for _, sitemap := range site.SitemapIndex {
+		site.IsMapped = site.IsMapped || sitemap.IsMapped
+	}
+	if !site.IsMapped {
+		if loadErr != nil {
+			return site, fmt.Errorf("MapSite failed: none of the %d sitemaps declared for %s could be fetched: %w", len(locations), baseURL, loadErr)
+		}
+		return site, fmt.Errorf("MapSite failed: none of the %d sitemaps declared for %s could be fetched", len(locations), baseURL)
+	}
+
+	return site, nil
+}
+
+// expandSitemapIndex fetches the children of node in place. Children are only
+// marked as mapped when their document was actually fetched and parsed; entries
+// that sit past maxDepth or point back at an ancestor are left untouched. Children
+// that fail carry the reason in Status and Error, the first such error of this
+// level is returned.
+func expandSitemapIndex(ctx context.Context, node *BackendSitemap, depth, maxDepth int, ancestors map[string]bool) error {
+	var firstErr error
+	for i := range node.SitemapIndex {
+		child := &node.SitemapIndex[i]
+		key := sitemapKey(child.Location)
+
+		if depth > maxDepth {
+			fmt.Printf("Sitemap depth limit %d reached, skipping %s\n", maxDepth, child.Location)
+			continue
+		}
+		if ancestors[key] {
+			fmt.Printf("Sitemap cycle detected, skipping %s\n", child.Location)
+			continue
+		}
+
+		// Once ctx has ended the load below fails with its error, not as disallowed.
+		if robots := robotsFor(ctx, child.Location); ctx.Err() == nil && !robots.Allowed(UserAgent, child.Location) {
+			fmt.Printf("Sitemap disallowed by robots.txt, skipping %s\n", child.Location)
+			child.Status = StatusDisallowed
+			continue
+		}
+
+		parsed, status, err := LoadSitemap(ctx, child.Location)
+		if err != nil {
+			fmt.Printf("Child sitemap load failed: %v\n", err)
+			child.Status = failureStatus(err)
+			child.Error = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		fillSitemapNode(child, parsed, status)
+
+		ancestors[key] = true
+		expandSitemapIndex(ctx, child, depth+1, maxDepth, ancestors)
+		delete(ancestors, key)
+	}
+	return firstErr
+}
+
+// fillSitemapNode marks node as mapped from its loaded document.
+func fillSitemapNode(node *BackendSitemap, parsed Sitemap, status FetchStatus) {
+	mapped := TransformToBackendModel(parsed)
+	node.SitemapIndex = mapped.SitemapIndex
+	node.UrlSet = mapped.UrlSet
+	node.IsMapped = true
+	node.Status = status
+}
+
+func failureStatus(err error) FetchStatus {
+	switch {
+	case errors.Is(err, ErrNotASitemap):
+		return StatusNotASitemap
+	case errors.Is(err, ErrMalformedXML):
+		return StatusMalformed
+	case isTimeout(err):
+		return StatusTimeout
+	default:
+		return StatusFailed
+	}
+}
+
+// sitemapKey normalises a sitemap location enough that trivially different
+// spellings of the same document are recognised as a cycle.
+func sitemapKey(location string) string {
+	u, err := url.Parse(strings.TrimSpace(location))
+	if err != nil {
+		return location
+	}
+	return strings.ToLower(u.Host) + strings.TrimRight(u.EscapedPath(), "/") + "?" + u.RawQuery
+}
+
+// StreamSite maps baseURL like MapSite, but hands every URL to emit as soon as
+// it is decoded instead of building the tree in memory. An error returned by
+// emit stops the whole stream.
+func StreamSite(ctx context.Context, baseURL string, maxDepth int, emit func(BackendUrl) error) error {
+	locations := checkRobots(ctx, baseURL)
+	if len(locations) == 0 {
+		return streamCommonSitemap(ctx, baseURL, maxDepth, emit)
+	}
+
+	mapped := 0
+	for _, location := range locations {
+		ok, err := streamSitemapAt(ctx, location, 0, maxDepth, map[string]bool{}, emit)
+		if err != nil {
+			return err
+		}
+		if ok {
+			mapped++
+		}
+	}
+
+	if mapped == 0 {
+		return fmt.Errorf("StreamSite failed: none of the %d sitemaps declared for %s could be fetched", len(locations), baseURL)
+	}
+	return nil
+}
+
+// streamCommonSitemap is StreamSite for sites that declare no sitemap. Each
+// common location is probed by streaming it, so the sitemap found is fetched
+// once rather than loaded whole by discovery and then again for the stream. As
+// in checkMostCommonConfigs, a location only counts once it yields a URL.
+func streamCommonSitemap(ctx context.Context, baseURL string, maxDepth int, emit func(BackendUrl) error) error {
+	emitted := 0
+	counted := func(u BackendUrl) error {
+		emitted++
+		return emit(u)
+	}
+
+	for _, path := range commonSitemaps {
+		location := strings.TrimRight(baseURL, "/") + path
+		if _, err := streamSitemapAt(ctx, location, 0, maxDepth, map[string]bool{}, counted); err != nil {
+			return err
+		}
+		if emitted > 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("StreamSite failed: no sitemap found at common locations for %s", baseURL)
+}
+
+// streamSitemapAt streams one sitemap and then the children its index lists,
+// applying the same depth, cycle and robots rules as expandSitemapIndex. It
+// reports whether the document was fetched; only emit errors and ctx's error
+// are returned.
+func streamSitemapAt(ctx context.Context, location string, depth, maxDepth int, ancestors map[string]bool, emit func(BackendUrl) error) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	key := sitemapKey(location)
+	if depth > maxDepth {
+		fmt.Printf("Sitemap depth limit %d reached, skipping %s\n", maxDepth, location)
+		return false, nil
+	}
+	if ancestors[key] {
+		fmt.Printf("Sitemap cycle detected, skipping %s\n", location)
+		return false, nil
+	}
+	robots := robotsFor(ctx, location)
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if !robots.Allowed(UserAgent, location) {
+		fmt.Printf("Sitemap disallowed by robots.txt, skipping %s\n", location)
+		return false, nil
+	}
+
+	resp, err := fetchSitemap(ctx, location)
+	if err != nil {
+		fmt.Printf("Child sitemap fetch failed: %v\n", err)
+		return false, nil
+	}
+	defer resp.Body.Close()
+
+	body, err := openSitemapBody(location, resp)
+	if err != nil {
+		fmt.Printf("Child sitemap decompress failed: %v\n", err)
+		return false, nil
+	}
+
+	var emitErr error
+	var children []string
+	err = StreamSitemap(body, SitemapHandler{
+		OnUrl: func(entry SitemapUrl) error {
+			emitErr = emit(transformUrl(entry))
+			return emitErr
+		},
+		OnSitemap: func(entry SitemapIndexEntry) error {
+			children = append(children, strings.TrimSpace(entry.Loc))
+			return nil
+		},
+	})
+	if emitErr != nil {
+		return true, emitErr
+	}
+	if errors.Is(err, ErrNotASitemap) {
+		fmt.Printf("Skipping %s: %v\n", location, err)
+		return false, nil
+	}
+	if err != nil {
+		fmt.Printf("Sitemap stream of %s stopped early: %v\n", location, err)
+	}
+	// The body is done with before recursing, so only one connection is open per level.
+	resp.Body.Close()
+
+	ancestors[key] = true
+	defer delete(ancestors, key)
+	for _, child := range children {
+		if _, err := streamSitemapAt(ctx, child, depth+1, maxDepth, ancestors, emit); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
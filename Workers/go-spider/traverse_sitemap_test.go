@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newSitemapServer serves each path in docs as an XML document, with {{host}}
+// replaced by the test server's base URL.
+func newSitemapServer(t *testing.T, docs map[string]string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, strings.ReplaceAll(doc, "{{host}}", server.URL))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func sitemapIndexDoc(locs ...string) string {
+	doc := `<?xml version="1.0" encoding="UTF-8"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`
+	for _, loc := range locs {
+		doc += "<sitemap><loc>{{host}}" + loc + "</loc></sitemap>"
+	}
+	return doc + "</sitemapindex>"
+}
+
+func urlSetDoc(locs ...string) string {
+	doc := `<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`
+	for _, loc := range locs {
+		doc += "<url><loc>{{host}}" + loc + "</loc></url>"
+	}
+	return doc + "</urlset>"
+}
+
+// mapSitemapIndex maps the test server, whose only sitemap is the index at
+// the common /sitemap_index.xml, and returns that index's node.
+func mapSitemapIndex(t *testing.T, server *httptest.Server, maxDepth int) BackendSitemap {
+	t.Helper()
+	site, err := MapSite(context.Background(), server.URL, maxDepth)
+	if err != nil {
+		t.Fatalf("MapSite failed: %v", err)
+	}
+	if len(site.SitemapIndex) != 1 || site.SitemapIndex[0].Location != server.URL+"/sitemap_index.xml" {
+		t.Fatalf("Expected the index as the only sitemap, got %+v", site.SitemapIndex)
+	}
+	return site.SitemapIndex[0]
+}
+
+func TestMapSiteFollowsNestedIndexes(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/sitemap_index.xml": sitemapIndexDoc("/posts.xml", "/nested_index.xml"),
+		"/posts.xml":         urlSetDoc("/post-1", "/post-2"),
+		"/nested_index.xml":  sitemapIndexDoc("/pages.xml"),
+		"/pages.xml":         urlSetDoc("/about"),
+	})
+
+	result := mapSitemapIndex(t, server, DefaultSitemapDepth)
+
+	if !result.IsMapped {
+		t.Error("Root sitemap should be mapped")
+	}
+	if len(result.SitemapIndex) != 2 {
+		t.Fatalf("Expected 2 child sitemaps, got %d", len(result.SitemapIndex))
+	}
+
+	posts := result.SitemapIndex[0]
+	if !posts.IsMapped || len(posts.UrlSet) != 2 {
+		t.Errorf("posts.xml not populated: mapped=%v urls=%d", posts.IsMapped, len(posts.UrlSet))
+	}
+
+	nested := result.SitemapIndex[1]
+	if !nested.IsMapped || len(nested.SitemapIndex) != 1 {
+		t.Fatalf("nested index not populated: mapped=%v children=%d", nested.IsMapped, len(nested.SitemapIndex))
+	}
+	if pages := nested.SitemapIndex[0]; !pages.IsMapped || len(pages.UrlSet) != 1 {
+		t.Errorf("pages.xml not populated: mapped=%v urls=%d", pages.IsMapped, len(pages.UrlSet))
+	}
+}
+
+func TestMapSiteRespectsMaxDepth(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/sitemap_index.xml": sitemapIndexDoc("/nested_index.xml"),
+		"/nested_index.xml":  sitemapIndexDoc("/pages.xml"),
+		"/pages.xml":         urlSetDoc("/about"),
+	})
+
+	result := mapSitemapIndex(t, server, 1)
+
+	nested := result.SitemapIndex[0]
+	if !nested.IsMapped {
+		t.Fatal("First level should be mapped at depth 1")
+	}
+	if pages := nested.SitemapIndex[0]; pages.IsMapped || len(pages.UrlSet) != 0 {
+		t.Errorf("Second level should not be fetched at depth 1: mapped=%v urls=%d", pages.IsMapped, len(pages.UrlSet))
+	}
+}
+
+func TestMapSiteDetectsCycles(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/sitemap_index.xml": sitemapIndexDoc("/sitemap_index.xml", "/loop.xml"),
+		"/loop.xml":          sitemapIndexDoc("/sitemap_index.xml/"),
+	})
+
+	result := mapSitemapIndex(t, server, 10)
+
+	if self := result.SitemapIndex[0]; self.IsMapped {
+		t.Error("Index pointing at itself should not be fetched")
+	}
+	loop := result.SitemapIndex[1]
+	if !loop.IsMapped {
+		t.Fatal("loop.xml should be mapped")
+	}
+	if back := loop.SitemapIndex[0]; back.IsMapped {
+		t.Error("Index pointing back at an ancestor should not be fetched")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "encoding/xml"
+
+// RssFeed covers RSS 2.0 (<rss><channel><item>) and RSS 1.0, where items sit
+// directly under <rdf:RDF>.
+type RssFeed struct {
+	XMLName xml.Name  `xml:""`
+	Items   []RssItem `xml:"channel>item"`
+	RdfItem []RssItem `xml:"item"`
+}
+
+type RssItem struct {
+	Link    string `xml:"link"`
+	Guid    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"date"`
+}
+
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+}
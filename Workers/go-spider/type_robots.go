@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+type Robots struct {
+	Groups   []RobotsGroup
+	Sitemaps []string
+
+	// DisallowAll is set when robots.txt could not be fetched because of a server
+	// error, RFC 9309 then treats the whole site as disallowed.
+	DisallowAll bool
+}
+
+type RobotsGroup struct {
+	UserAgents []string
+	Rules      []RobotsRule
+	CrawlDelay time.Duration
+}
+
+type RobotsRule struct {
+	Allow bool
+	Path  string
+}
@@ -10,13 +10,15 @@ type Sitemap struct {
 }
 
 type SitemapIndex struct {
-	XMLName xml.Name `xml:"sitemapindex"`
-	Text    string   `xml:",chardata"`
-	Sitemap []struct {
-		Text    string `xml:",chardata"`
-		Loc     string `xml:"loc"`
-		Lastmod string `xml:"lastmod"`
-	} `xml:"sitemap"`
+	XMLName xml.Name            `xml:"sitemapindex"`
+	Text    string              `xml:",chardata"`
+	Sitemap []SitemapIndexEntry `xml:"sitemap"`
+}
+
+type SitemapIndexEntry struct {
+	Text    string `xml:",chardata"`
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod"`
 }
 
 type UrlSet struct {
@@ -24,51 +26,83 @@ type UrlSet struct {
 	Xmlns   string   `xml:"xmlns,attr"`
 	Video   string   `xml:"video,attr"`
 
-	URL []struct {
-		Loc string `xml:"loc"`
-		// Image
-		Image []struct {
-			Loc string `xml:"loc"`
-		} `xml:"image"`
-		// Video
-		Video []struct {
-			ThumbnailLoc    string `xml:"thumbnail_loc"`
-			Title           string `xml:"title"`
-			Description     string `xml:"description"`
-			ContentLoc      string `xml:"content_loc"`
-			PlayerLoc       string `xml:"player_loc"`
-			Duration        string `xml:"duration"`
-			ExpirationDate  string `xml:"expiration_date"`
-			Rating          string `xml:"rating"`
-			ViewCount       string `xml:"view_count"`
-			PublicationDate string `xml:"publication_date"`
-			FamilyFriendly  string `xml:"family_friendly"`
+	URL []SitemapUrl `xml:"url"`
+}
+
+type SitemapUrl struct {
+	Loc        string `xml:"loc"`
+	Lastmod    string `xml:"lastmod"`
+	Changefreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+	// Alternate languages (xhtml:link)
+	Links []SitemapLink `xml:"link"`
+	// Image
+	Image []struct {
+		Loc         string `xml:"loc"`
+		Caption     string `xml:"caption"`
+		Title       string `xml:"title"`
+		GeoLocation string `xml:"geo_location"`
+		License     string `xml:"license"`
+	} `xml:"image"`
+	// Video
+	Video []struct {
+		ThumbnailLoc    string   `xml:"thumbnail_loc"`
+		Title           string   `xml:"title"`
+		Description     string   `xml:"description"`
+		ContentLoc      string   `xml:"content_loc"`
+		PlayerLoc       string   `xml:"player_loc"`
+		Duration        string   `xml:"duration"`
+		ExpirationDate  string   `xml:"expiration_date"`
+		Rating          string   `xml:"rating"`
+		ViewCount       string   `xml:"view_count"`
+		PublicationDate string   `xml:"publication_date"`
+		FamilyFriendly  string   `xml:"family_friendly"`
+		Tag             []string `xml:"tag"`
 
-			Restriction struct {
-				Relationship string `xml:"relationship,attr"`
-			} `xml:"restriction"`
+		Restriction struct {
+			Text         string `xml:",chardata"`
+			Relationship string `xml:"relationship,attr"`
+		} `xml:"restriction"`
 
-			Price struct {
-				Currency string `xml:"currency,attr"`
-			} `xml:"price"`
+		Platform struct {
+			Text         string `xml:",chardata"`
+			Relationship string `xml:"relationship,attr"`
+		} `xml:"platform"`
 
-			RequiresSubscription string `xml:"requires_subscription"`
+		Price []struct {
+			Text       string `xml:",chardata"`
+			Currency   string `xml:"currency,attr"`
+			Type       string `xml:"type,attr"`
+			Resolution string `xml:"resolution,attr"`
+		} `xml:"price"`
 
-			Uploader struct {
-				Info string `xml:"info,attr"`
-			} `xml:"uploader"`
+		RequiresSubscription string `xml:"requires_subscription"`
+
+		Uploader struct {
+			Text string `xml:",chardata"`
+			Info string `xml:"info,attr"`
+		} `xml:"uploader"`
+
+		Live string `xml:"live"`
+	} `xml:"video"`
+	// News
+	News struct {
+		Publication struct {
+			Text     string `xml:",chardata"`
+			Name     string `xml:"name"`
+			Language string `xml:"language"`
+		} `xml:"publication"`
+		PublicationDate string `xml:"publication_date"`
+		Title           string `xml:"title"`
+		Keywords        string `xml:"keywords"`
+		Genres          string `xml:"genres"`
+	} `xml:"news"`
+}
 
-			Live string `xml:"live"`
-		} `xml:"video"`
-		// News
-		News struct {
-			Publication struct {
-				Text     string `xml:",chardata"`
-				Name     string `xml:"name"`
-				Language string `xml:"language"`
-			} `xml:"publication"`
-			PublicationDate string `xml:"publication_date"`
-			Title           string `xml:"title"`
-		} `xml:"news"`
-	} `xml:"url"`
+// SitemapLink is an <xhtml:link> inside a <url>, used to declare the page in
+// other languages.
+type SitemapLink struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
 }
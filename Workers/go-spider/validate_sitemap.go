@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+
+	SitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+	maxLocLength = 2048
+)
+
+// documentIndex marks an issue that applies to the whole document rather than
+// one of its entries.
+const documentIndex = -1
+
+var validChangeFreqs = map[string]bool{
+	"always": true, "hourly": true, "daily": true, "weekly": true,
+	"monthly": true, "yearly": true, "never": true,
+}
+
+type ValidationIssue struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Index    int      `json:"index"`
+	Location string   `json:"location,omitempty"`
+}
+
+type ValidationReport struct {
+	Sitemap string            `json:"sitemap"`
+	Type    string            `json:"type"`
+	Size    int               `json:"size"`
+	Entries int               `json:"entries"`
+	Valid   bool              `json:"valid"`
+	Issues  []ValidationIssue `json:"issues"`
+}
+
+func (r *ValidationReport) add(severity Severity, code string, index int, location, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, ValidationIssue{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Index:    index,
+		Location: location,
+	})
+	if severity == SeverityError {
+		r.Valid = false
+	}
+}
+
+// ValidateSite validates every sitemap discovered for baseURL and the child
+// sitemaps their indexes list. Each document gets its own report.
+func ValidateSite(ctx context.Context, baseURL string) ([]ValidationReport, error) {
+	locations, err := FindSitemap(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []ValidationReport
+	for _, location := range locations {
+		reports = append(reports, validateSitemapAt(ctx, location, true)...)
+	}
+	return reports, nil
+}
+
+// validateSitemapAt fetches and validates one sitemap. For an index it also
+// validates each listed child, flagging children that are indexes themselves.
+func validateSitemapAt(ctx context.Context, location string, followIndex bool) []ValidationReport {
+	report := ValidationReport{Sitemap: location, Valid: true, Issues: []ValidationIssue{}}
+
+	// Once ctx has ended the fetch below fails with its error, not as disallowed.
+	if robots := robotsFor(ctx, location); ctx.Err() == nil && !robots.Allowed(UserAgent, location) {
+		report.add(SeverityError, "disallowed", documentIndex, location, "sitemap is disallowed by robots.txt")
+		return []ValidationReport{report}
+	}
+
+	data, err := GetSitemap(ctx, location)
+	if errors.Is(err, ErrSitemapTooLarge) {
+		report.add(SeverityError, "size_exceeded", documentIndex, location, "sitemap is larger than %d bytes uncompressed", MaxSitemapSize)
+		return []ValidationReport{report}
+	}
+	if err != nil {
+		report.add(SeverityError, "fetch_failed", documentIndex, location, "%v", err)
+		return []ValidationReport{report}
+	}
+
+	sitemap, err := ParseSitemap(location, data)
+	if errors.Is(err, ErrNotASitemap) {
+		report.Size = len(data)
+		report.add(SeverityError, "not_a_sitemap", documentIndex, location, "%v", err)
+		return []ValidationReport{report}
+	}
+	if err != nil {
+		report.Size = len(data)
+		report.add(SeverityError, "parse_failed", documentIndex, location, "%v", err)
+		return []ValidationReport{report}
+	}
+
+	report = ValidateSitemap(location, data, sitemap)
+	reports := []ValidationReport{report}
+	if report.Type != "sitemapindex" || !followIndex {
+		return reports
+	}
+
+	for i, child := range sitemap.SiteIndex.Sitemap {
+		childReports := validateSitemapAt(ctx, strings.TrimSpace(child.Loc), false)
+		if childReports[0].Type == "sitemapindex" {
+			reports[0].add(SeverityError, "nested_index", i, child.Loc, "sitemap index lists another sitemap index")
+		}
+		reports = append(reports, childReports...)
+	}
+	return reports
+}
+
+// ValidateSitemap checks an already parsed sitemap against the sitemap protocol:
+// entry limit, namespace, loc form and scope, lastmod, changefreq and priority
+// values, and hreflang alternates. The size limit is enforced while reading, see
+// validateSitemapAt.
+func ValidateSitemap(sitemapURL string, data []byte, sitemap Sitemap) ValidationReport {
+	report := ValidationReport{Sitemap: sitemapURL, Size: len(data), Valid: true, Issues: []ValidationIssue{}}
+
+	switch {
+	case sitemap.SiteIndex.XMLName.Local == "sitemapindex":
+		report.Type = "sitemapindex"
+		report.Entries = len(sitemap.SiteIndex.Sitemap)
+		validateNamespace(&report, sitemap.SiteIndex.XMLName.Space)
+		for i, entry := range sitemap.SiteIndex.Sitemap {
+			validateLoc(&report, sitemapURL, i, entry.Loc)
+			validateLastmod(&report, i, entry.Loc, entry.Lastmod)
+		}
+	case sitemap.UrlSet.XMLName.Local == "urlset":
+		report.Type = "urlset"
+		report.Entries = len(sitemap.UrlSet.URL)
+		validateNamespace(&report, sitemap.UrlSet.XMLName.Space)
+		validateUrlEntries(&report, sitemapURL, sitemap.UrlSet.URL)
+	case looksLikeXML(data):
+		report.Type = "feed"
+		report.Entries = len(sitemap.UrlSet.URL)
+		if report.Entries == 0 {
+			report.add(SeverityError, "not_a_sitemap", documentIndex, "", "document is not a urlset, sitemapindex or feed")
+		}
+		validateUrlEntries(&report, sitemapURL, sitemap.UrlSet.URL)
+	default:
+		report.Type = "text"
+		report.Entries = len(sitemap.UrlSet.URL)
+		if report.Entries == 0 {
+			report.add(SeverityError, "not_a_sitemap", documentIndex, "", "text sitemap contains no URLs")
+		}
+		validateUrlEntries(&report, sitemapURL, sitemap.UrlSet.URL)
+	}
+
+	if report.Entries > MaxSitemapUrls {
+		report.add(SeverityError, "too_many_entries", documentIndex, "", "sitemap has %d entries, the limit is %d", report.Entries, MaxSitemapUrls)
+	}
+
+	return report
+}
+
+func validateUrlEntries(report *ValidationReport, sitemapURL string, urls []SitemapUrl) {
+	for i, entry := range urls {
+		validateLoc(report, sitemapURL, i, entry.Loc)
+		validateLastmod(report, i, entry.Loc, entry.Lastmod)
+
+		if freq := strings.TrimSpace(entry.Changefreq); freq != "" && !validChangeFreqs[freq] {
+			report.add(SeverityError, "invalid_changefreq", i, entry.Loc, "changefreq %q is not one of always, hourly, daily, weekly, monthly, yearly, never", freq)
+		}
+
+		if priority := strings.TrimSpace(entry.Priority); priority != "" {
+			value, err := strconv.ParseFloat(priority, 64)
+			if err != nil || value < 0 || value > 1 {
+				report.add(SeverityError, "invalid_priority", i, entry.Loc, "priority %q is not between 0.0 and 1.0", priority)
+			}
+		}
+	}
+
+	validateAlternates(report, urls)
+}
+
+func validateNamespace(report *ValidationReport, namespace string) {
+	if namespace != SitemapNamespace {
+		report.add(SeverityError, "wrong_namespace", documentIndex, "", "namespace is %q, expected %q", namespace, SitemapNamespace)
+	}
+}
+
+// validateLoc checks that a loc is an absolute, escaped URL on the sitemap's
+// host. URLs outside the sitemap's directory are only a warning, since sitemaps
+// submitted through robots.txt may cover the whole host.
+func validateLoc(report *ValidationReport, sitemapURL string, index int, loc string) {
+	if loc != strings.TrimSpace(loc) {
+		report.add(SeverityWarning, "loc_whitespace", index, loc, "loc has surrounding whitespace")
+		loc = strings.TrimSpace(loc)
+	}
+	if len(loc) > maxLocLength {
+		report.add(SeverityError, "loc_too_long", index, loc, "loc is %d characters, the limit is %d", len(loc), maxLocLength)
+	}
+
+	u, err := url.Parse(loc)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		report.add(SeverityError, "loc_not_absolute", index, loc, "loc is not an absolute URL")
+		return
+	}
+	if !isEscapedURL(loc) {
+		report.add(SeverityError, "loc_not_escaped", index, loc, "loc contains characters that must be percent-encoded")
+	}
+
+	base, err := url.Parse(sitemapURL)
+	if err != nil || base.Host == "" {
+		return
+	}
+	if !strings.EqualFold(u.Scheme, base.Scheme) || !strings.EqualFold(u.Host, base.Host) {
+		report.add(SeverityError, "loc_outside_host", index, loc, "loc is not on the sitemap's host %s://%s", base.Scheme, base.Host)
+		return
+	}
+	if dir := path.Dir(base.Path); dir != "/" && dir != "." && !strings.HasPrefix(u.Path, dir+"/") {
+		report.add(SeverityWarning, "loc_outside_path", index, loc, "loc is outside the sitemap's directory %s", dir)
+	}
+}
+
+func validateLastmod(report *ValidationReport, index int, loc, lastmod string) {
+	if strings.TrimSpace(lastmod) == "" {
+		return
+	}
+	if _, zoneless, err := parseW3CDatetime(lastmod); err != nil {
+		report.add(SeverityError, "invalid_lastmod", index, loc, "lastmod %q is not a W3C Datetime", lastmod)
+	} else if zoneless {
+		report.add(SeverityWarning, "lastmod_missing_timezone", index, loc, "lastmod %q has a time but no timezone", lastmod)
+	}
+}
+
+// isEscapedURL reports whether raw only contains characters allowed unencoded
+// in a URL, anything else (spaces, quotes, non-ASCII) must be percent-encoded.
+func isEscapedURL(raw string) bool {
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c <= 0x20 || c >= 0x7f || strings.IndexByte(`"<>\^`+"`{|}", c) >= 0 {
+			return false
+		}
+		if c == '%' && (i+2 >= len(raw) || !isHex(raw[i+1]) || !isHex(raw[i+2])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func issueCodes(report ValidationReport) map[string]int {
+	codes := make(map[string]int)
+	for _, issue := range report.Issues {
+		codes[issue.Code] = issue.Index
+	}
+	return codes
+}
+
+func TestValidateSitemapReportsViolations(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://example.com/blog/ok</loc><lastmod>2025-06-10T04:00:00+00:00</lastmod><changefreq>daily</changefreq><priority>0.8</priority></url>
+<url><loc>https://other.example.org/blog/page</loc></url>
+<url><loc>https://example.com/shop/page</loc></url>
+<url><loc>/blog/relative</loc></url>
+<url><loc>https://example.com/blog/with space</loc></url>
+<url><loc>https://example.com/blog/a</loc><lastmod>10/06/2025</lastmod></url>
+<url><loc>https://example.com/blog/b</loc><priority>1.5</priority></url>
+<url><loc>https://example.com/blog/c</loc><changefreq>sometimes</changefreq></url>
+<url><loc>https://example.com/blog/d</loc><lastmod>2025-06-10T04:00:00</lastmod></url>
+</urlset>`)
+
+	sitemap, _ := ParseSitemap("https://example.com/blog/sitemap.xml", data)
+	report := ValidateSitemap("https://example.com/blog/sitemap.xml", data, sitemap)
+
+	if report.Valid || report.Type != "urlset" || report.Entries != 9 {
+		t.Errorf("Unexpected report summary: valid=%v type=%s entries=%d", report.Valid, report.Type, report.Entries)
+	}
+
+	expected := map[string]int{
+		"loc_outside_host":         1,
+		"loc_outside_path":         2,
+		"loc_not_absolute":         3,
+		"loc_not_escaped":          4,
+		"invalid_lastmod":          5,
+		"invalid_priority":         6,
+		"invalid_changefreq":       7,
+		"lastmod_missing_timezone": 8,
+	}
+	codes := issueCodes(report)
+	for code, index := range expected {
+		if got, ok := codes[code]; !ok || got != index {
+			t.Errorf("Expected %s at index %d, got %v (present=%v)", code, index, got, ok)
+		}
+	}
+	if len(report.Issues) != len(expected) {
+		t.Errorf("Expected %d issues, got %+v", len(expected), report.Issues)
+	}
+}
+
+func TestValidateSitemapWrongNamespaceAndLimits(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`<urlset xmlns="http://www.google.com/schemas/sitemap/0.84">`)
+	for i := 0; i <= MaxSitemapUrls; i++ {
+		b.WriteString("<url><loc>https://example.com/p</loc></url>")
+	}
+	b.WriteString("</urlset>")
+	data := []byte(b.String())
+
+	sitemap, _ := ParseSitemap("https://example.com/sitemap.xml", data)
+	codes := issueCodes(ValidateSitemap("https://example.com/sitemap.xml", data, sitemap))
+
+	for _, code := range []string{"wrong_namespace", "too_many_entries"} {
+		if index, ok := codes[code]; !ok || index != documentIndex {
+			t.Errorf("Expected document level %s issue, got %v", code, codes)
+		}
+	}
+}
+
+func TestValidateRequestFlagsNestedIndexes(t *testing.T) {
+	server := newSitemapServer(t, map[string]string{
+		"/robots.txt": "Sitemap: {{host}}/index.xml\n",
+		"/index.xml":  sitemapIndexDoc("/pages.xml", "/nested.xml"),
+		"/pages.xml":  urlSetDoc("/about"),
+		"/nested.xml": sitemapIndexDoc("/pages.xml"),
+	})
+
+	rec := httptest.NewRecorder()
+	validateRequestHandler(rec, httptest.NewRequest(http.MethodGet, "/validate?url="+server.URL, nil))
+
+	var reports []ValidationReport
+	if err := json.NewDecoder(rec.Body).Decode(&reports); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("Expected reports for the index and both children, got %d", len(reports))
+	}
+	if index, ok := issueCodes(reports[0])["nested_index"]; !ok || index != 1 {
+		t.Errorf("Expected nested_index at entry 1, got %+v", reports[0].Issues)
+	}
+	if !reports[1].Valid {
+		t.Errorf("pages.xml should be valid, got %+v", reports[1].Issues)
+	}
+}
+
+func TestValidateRequestHasDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stuck.xml" {
+			<-r.Context().Done()
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	rec := httptest.NewRecorder()
+	validateRequestHandler(rec, httptest.NewRequest(http.MethodGet, "/validate?timeout=bogus&sitemap="+server.URL+"/stuck.xml", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid timeout, got %d", rec.Code)
+	}
+
+	started := time.Now()
+	rec = httptest.NewRecorder()
+	validateRequestHandler(rec, httptest.NewRequest(http.MethodGet, "/validate?timeout=300ms&sitemap="+server.URL+"/stuck.xml", nil))
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Request should end at its deadline, took %s", elapsed)
+	}
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 once the deadline passed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}